@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"lidar-classification/internal/app"
+	"lidar-classification/internal/domain"
+	"lidar-classification/internal/infrastructure"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sessionDoneFile — отметка об успешной обработке сеанса в его выходном
+// каталоге с хешем входных данных и конфигурации, seed и статистикой сеанса.
+// Записывается при включенных контрольных точках, чтобы при -resume
+// пропускать сеансы, обработанные до прерывания с теми же данными.
+const sessionDoneFile = "session_done.txt"
+
+// sessionSummary — строка сводной таблицы пакетной обработки
+type sessionSummary struct {
+	Session  string
+	Status   string
+	Stats    sessionStats
+	Duration time.Duration
+}
+
+// runBatch обрабатывает все сеансы измерений в дереве каталогов и записывает
+// результаты каждого сеанса в зеркальное дерево внутри каталога output.dir.
+// Сеансом считается каталог, содержащий все три входные матрицы (имена файлов
+// берутся из секции input конфигурации, регистр не учитывается).
+func runBatch(args []string) {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to config file")
+	root := flags.String("root", ".", "Root directory with measurement sessions")
+	infrastructure.RegisterFlags(flags)
+	flags.Parse(args)
+
+	logger, config := loadConfig(*configPath, flags)
+	defer logger.Sync()
+
+	sessions, err := findSessions(*root, config.Input, config.Output.Dir)
+	if err != nil {
+		logger.Fatal("Failed to scan session directories", zap.String("root", *root), zap.Error(err))
+	}
+	logger.Info("Found measurement sessions", zap.String("root", *root), zap.Int("count", len(sessions)))
+
+	ctx, cancel := processContext(config)
+	defer cancel()
+
+	classifier := app.NewAerosolClassifier(logger, config)
+
+	// Новый запуск пакета обрабатывает все сеансы заново: прежние отметки
+	// могли быть получены с другой конфигурацией
+	if !config.Checkpoint.Resume {
+		for _, session := range sessions {
+			doneFile := outputPath(config, sessionOutDir(*root, session.Dir, config.Output.Dir), sessionDoneFile)
+			if err := os.Remove(doneFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				logger.Error("Failed to remove session completion mark", zap.String("file", doneFile), zap.Error(err))
+			}
+		}
+	}
+
+	summary := make([]sessionSummary, 0, len(sessions))
+	failed := 0
+	for _, session := range sessions {
+		rel := sessionRel(*root, session.Dir)
+		outDir := sessionOutDir(*root, session.Dir, config.Output.Dir)
+		doneFile := outputPath(config, outDir, sessionDoneFile)
+
+		// После прерывания оставшиеся сеансы только отмечаются в сводной таблице
+		if ctx.Err() != nil {
+			summary = append(summary, sessionSummary{
+				Session: rel,
+				Status:  "skipped",
+				Stats:   sessionStats{MeanResidual: math.NaN()},
+			})
+			continue
+		}
+
+		start := time.Now()
+		data, err := readSession(logger, config, session.Input)
+		var hash string
+		if err == nil && config.Checkpoint.Enabled {
+			hash, err = app.InputHash(config, data.Dep, data.FlCap, data.Mre, data.Errs)
+		}
+
+		// При продолжении пакета сеансы, обработанные до прерывания с теми же
+		// входными данными и конфигурацией, не пересчитываются
+		if err == nil && config.Checkpoint.Resume {
+			if stats, ok := sessionCompleted(logger, config, doneFile, hash); ok {
+				summary = append(summary, sessionSummary{
+					Session: rel,
+					Status:  "completed earlier",
+					Stats:   stats,
+				})
+				logger.Info("Session already completed, skipping", zap.String("session", rel))
+				continue
+			}
+		}
+
+		var stats sessionStats
+		if err == nil {
+			stats, err = runSession(ctx, logger, config, classifier, data, outDir)
+		}
+		item := sessionSummary{
+			Session:  rel,
+			Stats:    stats,
+			Duration: time.Since(start),
+		}
+
+		switch {
+		case err != nil:
+			failed++
+			item.Stats.MeanResidual = math.NaN()
+			item.Status = "error: " + err.Error()
+			logger.Error("Session failed", zap.String("session", rel), zap.Error(err))
+		case stats.Solved == 0:
+			item.Status = "no solutions"
+			logger.Warn("Session has no valid solutions", zap.String("session", rel))
+		default:
+			item.Status = "ok"
+			logger.Info("Session completed",
+				zap.String("session", rel),
+				zap.Int("solved", stats.Solved),
+				zap.Duration("duration", item.Duration))
+		}
+		if err == nil && config.Checkpoint.Enabled {
+			if err := writeSessionDone(doneFile, hash, stats); err != nil {
+				logger.Error("Failed to write session completion mark", zap.String("file", doneFile), zap.Error(err))
+			}
+		}
+		summary = append(summary, item)
+	}
+
+	summaryFile := outputPath(config, config.Output.Dir, "summary.txt")
+	if err := os.MkdirAll(config.Output.Dir, 0o755); err != nil {
+		logger.Fatal("Failed to create output directory", zap.String("dir", config.Output.Dir), zap.Error(err))
+	}
+	if err := writeSummary(summaryFile, summary); err != nil {
+		logger.Error("Failed to write result", zap.String("file", summaryFile), zap.Error(err))
+	} else {
+		logger.Info("Successfully written result", zap.String("file", summaryFile))
+	}
+
+	if ctx.Err() != nil {
+		logger.Fatal("Batch processing interrupted",
+			zap.Int("sessions", len(sessions)),
+			zap.Int("failed", failed),
+			zap.Error(ctx.Err()))
+	}
+
+	logger.Info("Batch processing completed",
+		zap.Int("sessions", len(sessions)),
+		zap.Int("failed", failed))
+}
+
+// sessionRel возвращает путь каталога сеанса относительно корня дерева
+func sessionRel(root, dir string) string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return filepath.Base(dir)
+	}
+	return rel
+}
+
+// sessionOutDir возвращает выходной каталог сеанса в зеркальном дереве outDir
+func sessionOutDir(root, dir, outDir string) string {
+	return filepath.Join(outDir, sessionRel(root, dir))
+}
+
+// sessionCompleted проверяет отметку об обработке сеанса и возвращает его
+// статистику, если сеанс обработан с теми же входными данными и параметрами
+// конфигурации (hash) и с тем же seed, когда он задан явно. Причина повторной
+// обработки записывается в журнал.
+func sessionCompleted(logger *zap.Logger, config *domain.Config, doneFile, hash string) (sessionStats, bool) {
+	doneHash, stats, err := readSessionDone(doneFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return stats, false
+	case err != nil:
+		logger.Warn("Failed to read session completion mark, processing session again",
+			zap.String("file", doneFile), zap.Error(err))
+		return stats, false
+	case doneHash != hash:
+		logger.Warn("Input data or config changed since the session was completed, processing session again",
+			zap.String("file", doneFile))
+		return stats, false
+	case config.Seed != 0 && config.Seed != stats.Seed:
+		logger.Warn("Session was completed with another seed, processing session again",
+			zap.String("file", doneFile),
+			zap.Int64("done_seed", stats.Seed),
+			zap.Int64("seed", config.Seed))
+		return stats, false
+	}
+	return stats, true
+}
+
+// writeSessionDone записывает отметку об обработке сеанса с хешем входных
+// данных и конфигурации, seed и статистикой сеанса
+func writeSessionDone(filename, hash string, stats sessionStats) error {
+	text := fmt.Sprintf("Hash\tSeed\tRows\tCols\tSolved\tMeanResidual\n%s\t%d\t%d\t%d\t%d\t%s\n",
+		hash, stats.Seed, stats.Rows, stats.Cols, stats.Solved, strconv.FormatFloat(stats.MeanResidual, 'g', -1, 64))
+	return os.WriteFile(filename, []byte(text), 0o644)
+}
+
+// readSessionDone читает хеш и статистику сеанса из отметки об обработке
+func readSessionDone(filename string) (string, sessionStats, error) {
+	var stats sessionStats
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", stats, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		return "", stats, fmt.Errorf("expected header and one line, got %d lines", len(lines))
+	}
+	fields := strings.Split(lines[1], "\t")
+	if len(fields) != 6 {
+		return "", stats, fmt.Errorf("expected 6 fields, got %d", len(fields))
+	}
+	if stats.Seed, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return "", stats, err
+	}
+	if stats.Rows, err = strconv.Atoi(fields[2]); err != nil {
+		return "", stats, err
+	}
+	if stats.Cols, err = strconv.Atoi(fields[3]); err != nil {
+		return "", stats, err
+	}
+	if stats.Solved, err = strconv.Atoi(fields[4]); err != nil {
+		return "", stats, err
+	}
+	if stats.MeanResidual, err = strconv.ParseFloat(fields[5], 64); err != nil {
+		return "", stats, err
+	}
+	return fields[0], stats, nil
+}
+
+// session — каталог сеанса измерений и найденные в нем входные файлы
+type session struct {
+	Dir   string
+	Input domain.InputFiles
+}
+
+// findSessions обходит дерево root и возвращает каталоги, содержащие все
+// входные матрицы. Матрицы погрешностей подключаются, если они есть в каталоге.
+// Каталог outDir, если он находится внутри root, пропускается.
+func findSessions(root string, input domain.InputFiles, outDir string) ([]session, error) {
+	depName := strings.ToLower(filepath.Base(input.Dep))
+	flName := strings.ToLower(filepath.Base(input.FlCap))
+	mreName := strings.ToLower(filepath.Base(input.Mre))
+
+	absOut, _ := filepath.Abs(outDir)
+
+	var sessions []session
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == absOut && path != root {
+			return filepath.SkipDir
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		files := make(map[string]string, len(entries))
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files[strings.ToLower(entry.Name())] = entry.Name()
+			}
+		}
+
+		dep, okDep := files[depName]
+		fl, okFl := files[flName]
+		mre, okMre := files[mreName]
+		if okDep && okFl && okMre {
+			sessions = append(sessions, session{
+				Dir: path,
+				Input: domain.InputFiles{
+					Dep:      filepath.Join(path, dep),
+					FlCap:    filepath.Join(path, fl),
+					Mre:      filepath.Join(path, mre),
+					DepErr:   optionalFile(path, files, input.DepErr),
+					FlCapErr: optionalFile(path, files, input.FlCapErr),
+					MreErr:   optionalFile(path, files, input.MreErr),
+				},
+			})
+		}
+		return nil
+	})
+	return sessions, err
+}
+
+// optionalFile возвращает путь к файлу с именем как у configured в каталоге dir
+// или пустую строку, если файл не настроен или отсутствует
+func optionalFile(dir string, files map[string]string, configured string) string {
+	if configured == "" {
+		return ""
+	}
+	name, ok := files[strings.ToLower(filepath.Base(configured))]
+	if !ok {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// summaryField заменяет разделители столбцов и строк сводной таблицы:
+// сообщения об ошибках (errors.Join, проверка конфигурации) многострочны
+var summaryField = strings.NewReplacer("\t", " ", "\r\n", "; ", "\n", "; ", "\r", "; ")
+
+// writeSummary записывает сводную таблицу пакетной обработки
+func writeSummary(filename string, summary []sessionSummary) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprintf(writer, "Session\tStatus\tRows\tCols\tPoints\tSolved\tMeanResidual\tDuration\n")
+	for _, item := range summary {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			summaryField.Replace(item.Session),
+			summaryField.Replace(item.Status),
+			item.Stats.Rows,
+			item.Stats.Cols,
+			item.Stats.Rows*item.Stats.Cols,
+			item.Stats.Solved,
+			strconv.FormatFloat(item.Stats.MeanResidual, 'f', 4, 64),
+			item.Duration.Round(time.Millisecond))
+	}
+
+	// Ошибки записи буфер сохраняет до Flush
+	err = writer.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,68 +1,238 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"lidar-classification/internal/app"
 	"lidar-classification/internal/domain"
 	"lidar-classification/internal/infrastructure"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		runBatch(os.Args[2:])
+		return
+	}
+
 	configPath := flag.String("config", "config.yaml", "Path to config file")
+	infrastructure.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	// Инициализация логгера
-	logger := initLogger("info")
+	logger, config := loadConfig(*configPath, flag.CommandLine)
 	defer logger.Sync()
 
+	ctx, cancel := processContext(config)
+	defer cancel()
+
+	// Инициализация компонентов
+	classifier := app.NewAerosolClassifier(logger, config)
+
+	data, err := readSession(logger, config, config.Input)
+	if err != nil {
+		logger.Fatal("Aerosol classification failed", zap.Error(err))
+	}
+	if _, err := runSession(ctx, logger, config, classifier, data, config.Output.Dir); err != nil {
+		if ctx.Err() != nil {
+			logger.Fatal("Aerosol classification interrupted", zap.Error(err))
+		}
+		logger.Fatal("Aerosol classification failed", zap.Error(err))
+	}
+
+	logger.Info("Aerosol classification completed successfully")
+}
+
+// loadConfig читает конфигурацию и создает логгер с указанными в ней уровнем и файлом
+func loadConfig(configPath string, flags *flag.FlagSet) (*zap.Logger, *domain.Config) {
+	// Инициализация логгера (до чтения конфигурации пишем в stderr)
+	logger := initLogger("info", "stderr")
+
 	// Чтение конфигурации
-	configReader := infrastructure.NewYAMLConfigReader(logger)
-	config, err := configReader.ReadConfig(*configPath)
+	configReader := infrastructure.NewYAMLConfigReader(logger, flags)
+	config, err := configReader.ReadConfig(configPath)
 	if err != nil {
-		logger.Fatal("Failed to read config", zap.Error(err))
+		// Ошибки проверки выводим по одной, чтобы каждая была видна отдельно
+		var problems interface{ Unwrap() []error }
+		if errors.As(err, &problems) {
+			for _, problem := range problems.Unwrap() {
+				logger.Error("Invalid config", zap.String("problem", problem.Error()))
+			}
+		}
+		logger.Fatal("Failed to read config", zap.String("file", configPath), zap.Error(err))
 	}
 
 	// Обновляем уровень логирования
-	logger = initLogger(config.LogLevel, config.LogFile)
+	return initLogger(config.LogLevel, config.LogFile), config
+}
 
-	// Инициализация компонентов
-	fileReader := infrastructure.NewTXTFileReader(logger)
-	fileWriter := infrastructure.NewTXTFileWriter(logger)
-	classifier := app.NewAerosolClassifier(logger, config)
+// processContext возвращает контекст обработки, отменяемый по сигналу
+// прерывания (Ctrl-C, SIGTERM) и по истечении config.Timeout. После отмены
+// восстанавливается обработка сигналов по умолчанию, поэтому повторный
+// Ctrl-C завершает программу сразу.
+func processContext(config *domain.Config) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	cancel := stop
+	if config.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, config.Timeout)
+		cancel = func() {
+			cancelTimeout()
+			stop()
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, cancel
+}
+
+// sessionStats содержит итоговую статистику обработки одного набора входных данных
+type sessionStats struct {
+	Rows, Cols   int
+	Solved       int
+	MeanResidual float64
+	// Seed — seed, с которым получены результаты
+	Seed int64
+}
+
+// sessionData — входные матрицы одного набора данных
+type sessionData struct {
+	Input           domain.InputFiles
+	Dep, FlCap, Mre *domain.MatrixData
+	Errs            domain.MeasurementErrors
+}
 
-	// Чтение входных данных
-	depData, err := fileReader.ReadMatrix("Dep.txt")
+// readSession читает входные матрицы и проверяет совместимость их размеров
+func readSession(logger *zap.Logger, config *domain.Config, input domain.InputFiles) (*sessionData, error) {
+	data := &sessionData{Input: input}
+	var err error
+
+	data.Dep, err = readMatrix(logger, input.Dep, config.NetCDF.DepVar, config.NetCDF)
 	if err != nil {
-		logger.Fatal("Failed to read Dep.txt", zap.Error(err))
+		return nil, fmt.Errorf("read depolarization data %s: %w", input.Dep, err)
 	}
 
-	flData, err := fileReader.ReadMatrix("FL_cap.txt")
+	data.FlCap, err = readMatrix(logger, input.FlCap, config.NetCDF.FlCapVar, config.NetCDF)
 	if err != nil {
-		logger.Fatal("Failed to read FL_cap.txt", zap.Error(err))
+		return nil, fmt.Errorf("read fluorescence capacity data %s: %w", input.FlCap, err)
 	}
 
-	mreData, err := fileReader.ReadMatrix("mre.txt")
+	data.Mre, err = readMatrix(logger, input.Mre, config.NetCDF.MreVar, config.NetCDF)
 	if err != nil {
-		logger.Fatal("Failed to read mre.txt", zap.Error(err))
+		return nil, fmt.Errorf("read refractive index data %s: %w", input.Mre, err)
+	}
+
+	// Необязательные погрешности измерений
+	errs := &data.Errs
+	if errs.Dep, err = readOptionalMatrix(logger, input.DepErr, config.NetCDF.DepErrVar, config.NetCDF); err != nil {
+		return nil, fmt.Errorf("read depolarization uncertainty %s: %w", input.DepErr, err)
+	}
+	if errs.FlCap, err = readOptionalMatrix(logger, input.FlCapErr, config.NetCDF.FlCapErrVar, config.NetCDF); err != nil {
+		return nil, fmt.Errorf("read fluorescence capacity uncertainty %s: %w", input.FlCapErr, err)
+	}
+	if errs.Mre, err = readOptionalMatrix(logger, input.MreErr, config.NetCDF.MreErrVar, config.NetCDF); err != nil {
+		return nil, fmt.Errorf("read refractive index uncertainty %s: %w", input.MreErr, err)
+	}
+	if given := countNonNil(errs.Dep, errs.FlCap, errs.Mre); given > 0 && given < 3 {
+		// Невязки с погрешностью измеряются в sigma, без нее — в долях значения
+		logger.Warn("Uncertainties are given only for some inputs, residuals mix sigma and relative scales",
+			zap.String("dep_err", input.DepErr),
+			zap.String("fl_cap_err", input.FlCapErr),
+			zap.String("mre_err", input.MreErr))
 	}
 
 	// Проверка совместимости размеров
-	if !validateMatrixSizes(depData, flData, mreData) {
-		logger.Fatal("Input matrices have incompatible sizes")
+	matrices := []*domain.MatrixData{data.Dep, data.FlCap, data.Mre}
+	for _, m := range []*domain.MatrixData{errs.Dep, errs.FlCap, errs.Mre} {
+		if m != nil {
+			matrices = append(matrices, m)
+		}
 	}
+	if !validateMatrixSizes(matrices...) {
+		return nil, errors.New("input matrices have incompatible sizes")
+	}
+	return data, nil
+}
+
+// runSession выполняет классификацию входных данных и записывает результаты
+// в каталог outDir. Если обработка прервана через ctx, записываются
+// результаты обработанных точек и маска completed, а возвращается ошибка.
+func runSession(ctx context.Context, logger *zap.Logger, config *domain.Config, classifier *app.AerosolClassifier,
+	data *sessionData, outDir string) (sessionStats, error) {
+
+	var stats sessionStats
+	depData, flData, mreData, errs := data.Dep, data.FlCap, data.Mre, data.Errs
 
 	logger.Info("Starting aerosol classification",
+		zap.String("dep", data.Input.Dep),
 		zap.Int("rows", depData.Rows),
 		zap.Int("cols", depData.Cols),
-		zap.Int("workers", config.Workers))
+		zap.Int("workers", config.Workers),
+		zap.String("mode", config.Mode),
+		zap.String("averaging", config.Averaging))
 
 	// Обработка данных
-	results := classifier.ProcessMatrices(depData, flData, mreData)
+	var opts app.ProcessOptions
+	if config.Checkpoint.Enabled || config.Dump.Enabled() {
+		if err := os.MkdirAll(outDir, 0o755); err != nil {
+			return stats, fmt.Errorf("create output directory %s: %w", outDir, err)
+		}
+	}
+	if config.Checkpoint.Enabled {
+		opts.Checkpoint = infrastructure.NewGobCheckpointStore(logger, outputPath(config, outDir, config.Checkpoint.File))
+	}
+	if config.Progress.Enabled {
+		opts.Progress = infrastructure.NewProgressReporter(logger, os.Stderr, config.Progress.Interval)
+	}
+	if config.Dump.Enabled() {
+		if config.GetMode() == domain.ModeMonteCarlo {
+			opts.Dump = infrastructure.NewSampleDumpWriter(logger, outDir, config.Output.Prefix, config.Dump.Format, config.Components)
+		} else {
+			logger.Warn("Sample dump is supported only in montecarlo mode")
+		}
+	}
+
+	results, completed, seed, procErr := classifier.ProcessMatrices(ctx, depData, flData, mreData, errs, opts)
+	if results == nil {
+		return stats, procErr
+	}
+	// Метаданные результатов содержат seed, с которым они фактически получены
+	if seed != config.Seed {
+		resolved := *config
+		resolved.Seed = seed
+		config = &resolved
+	}
+	if procErr != nil {
+		// Маска позволяет отличить необработанные точки от точек без решения
+		results["completed"] = completed
+		logger.Warn("Classification interrupted, writing partial results",
+			zap.Int("completed", countValues(completed, 1)),
+			zap.Int("points", depData.Rows*depData.Cols),
+			zap.Error(procErr))
+	}
+
+	if converged, ok := results["converged"]; ok {
+		if count := countValues(converged, 0); count > 0 {
+			logger.Warn("MCMC chains did not converge, posterior estimates are unreliable",
+				zap.Int("points", count),
+				zap.Float64("max_rhat", config.MCMC.MaxRHat),
+				zap.Int("max_steps", config.MCMC.MaxSteps))
+		}
+	}
 
 	// Сохранение меток
 	for _, result := range results {
@@ -71,95 +241,72 @@ func main() {
 	}
 
 	// Запись результатов
-	outputFiles := map[string]string{
-		"residuals": "residuals.txt",
-		"n_d":       "n_d.txt",
-		"n_u":       "n_u.txt",
-		"n_s":       "n_s.txt",
-		"n_w":       "n_w.txt",
-		"GF_d":      "GF_d.txt",
-		"GF_u":      "GF_u.txt",
-		"GF_s":      "GF_s.txt",
-		"GF_w":      "GF_w.txt",
-		"delta_d":   "delta_d.txt",
-		"delta_u":   "delta_u.txt",
-		"delta_s":   "delta_s.txt",
-		"delta_w":   "delta_w.txt",
-		"mre_d":     "mre_d.txt",
-		"mre_u":     "mre_u.txt",
-		"mre_s":     "mre_s.txt",
-		"mre_w":     "mre_w.txt",
-		"diff_eq1":  "diff_eq1.txt",
-		"diff_eq2":  "diff_eq2.txt",
-		"diff_eq3":  "diff_eq3.txt",
-		"diff_eq4":  "diff_eq4.txt",
+	if err := writeResults(logger, config, results, outDir); err != nil {
+		return stats, fmt.Errorf("write results to %s: %w", outDir, err)
 	}
-	// and histograms
-	histOutputFiles := map[string]string{
-		"n_d":     "hist-n_d.txt",
-		"n_u":     "hist-n_u.txt",
-		"n_s":     "hist-n_s.txt",
-		"n_w":     "hist-n_w.txt",
-		"GF_d":    "hist-GF_d.txt",
-		"GF_u":    "hist-GF_u.txt",
-		"GF_s":    "hist-GF_s.txt",
-		"GF_w":    "hist-GF_w.txt",
-		"delta_d": "hist-delta_d.txt",
-		"delta_u": "hist-delta_u.txt",
-		"delta_s": "hist-delta_s.txt",
-		"delta_w": "hist-delta_w.txt",
-		"mre_d":   "hist-mre_d.txt",
-		"mre_u":   "hist-mre_u.txt",
-		"mre_s":   "hist-mre_s.txt",
-		"mre_w":   "hist-mre_w.txt",
+
+	stats.Rows, stats.Cols = depData.Rows, depData.Cols
+	stats.Seed = seed
+	stats.Solved, stats.MeanResidual = residualStats(results["residuals"])
+	if procErr != nil {
+		return stats, fmt.Errorf("classification interrupted: %w", procErr)
 	}
 
-	fmtGf := func(val float64) string {
-		return strconv.FormatFloat(val, 'f', config.DecimalsGf, 64)
+	// Контрольная точка больше не нужна только после записи всех результатов
+	if opts.Checkpoint != nil {
+		if err := opts.Checkpoint.Remove(); err != nil {
+			logger.Error("Failed to remove checkpoint", zap.Error(err))
+		}
 	}
 
-	fmgDefault := func(val float64) string {
-		return strconv.FormatFloat(val, 'f', config.DecimalsDefault, 64)
+	// Маска completed прерванного ранее запуска не относится к полным результатам
+	completedFile := outputPath(config, outDir, "completed.txt")
+	if err := os.Remove(completedFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Error("Failed to remove stale completed mask", zap.String("file", completedFile), zap.Error(err))
 	}
+	return stats, nil
+}
 
-	var fmtStr infrastructure.FmtFunc
-	for key, filename := range outputFiles {
-		if strings.HasPrefix(key, "GF") {
-			fmtStr = fmtGf
-		} else {
-			fmtStr = fmgDefault
+// countNonNil возвращает число заданных матриц
+func countNonNil(matrices ...*domain.MatrixData) int {
+	count := 0
+	for _, m := range matrices {
+		if m != nil {
+			count++
 		}
+	}
+	return count
+}
 
-		if err := fileWriter.WriteMatrix(filename, results[key], fmtStr); err != nil {
-			logger.Error("Failed to write result",
-				zap.String("file", filename),
-				zap.Error(err))
-		} else {
-			logger.Info("Successfully written result",
-				zap.String("file", filename))
+// countValues возвращает число элементов матрицы, равных value
+func countValues(m *domain.MatrixData, value float64) int {
+	count := 0
+	for _, row := range m.Data {
+		for _, v := range row {
+			if v == value {
+				count++
+			}
 		}
-
 	}
+	return count
+}
 
-	for key, filename := range histOutputFiles {
-		tmp := results[key]
-		hist, err := tmp.Hist(0, 0, 20)
-		if err != nil {
-			logger.Error("Failed to calculate histogram",
-				zap.String("file", filename),
-				zap.Error(err))
-		} else if err := fileWriter.WriteHistogram(filename, &hist); err != nil {
-			logger.Error("Failed to write result",
-				zap.String("file", filename),
-				zap.Error(err))
-		} else {
-			logger.Info("Successfully written result",
-				zap.String("file", filename))
+// residualStats возвращает количество решенных точек и среднюю невязку по ним
+func residualStats(residuals *domain.MatrixData) (int, float64) {
+	count := 0
+	sum := 0.0
+	for _, row := range residuals.Data {
+		for _, value := range row {
+			if !math.IsNaN(value) {
+				count++
+				sum += value
+			}
 		}
-
 	}
-
-	logger.Info("Aerosol classification completed successfully")
+	if count == 0 {
+		return 0, math.NaN()
+	}
+	return count, sum / float64(count)
 }
 
 // initLogger initializes the logger with the specified level and log file name.
@@ -192,6 +339,143 @@ func initLogger(level string, logfileName ...string) *zap.Logger {
 	return logger
 }
 
+// readMatrix читает входную матрицу, выбирая формат по расширению файла
+func readMatrix(logger *zap.Logger, path, variable string, vars domain.NetCDFVars) (*domain.MatrixData, error) {
+	var reader domain.FileReader
+	if infrastructure.IsNetCDFFile(path) {
+		reader = infrastructure.NewNetCDFFileReader(logger, variable, vars.AltitudeVar, vars.TimeVar)
+	} else {
+		reader = infrastructure.NewTXTFileReader(logger)
+	}
+	return reader.ReadMatrix(path)
+}
+
+// readOptionalMatrix читает матрицу, если путь задан, иначе возвращает nil
+func readOptionalMatrix(logger *zap.Logger, path, variable string, vars domain.NetCDFVars) (*domain.MatrixData, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return readMatrix(logger, path, variable, vars)
+}
+
+// writeResults записывает результаты в каталог outDir в форматах, заданных
+// конфигурацией. Каталог создается при необходимости. Запись продолжается
+// после ошибки в одном из файлов; возвращаются ошибки всех незаписанных файлов.
+func writeResults(logger *zap.Logger, config *domain.Config, results domain.ClassifyResults, outDir string) error {
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return fmt.Errorf("create output directory: %w", err)
+	}
+
+	var errs []error
+	if config.OutputFormat != "netcdf" {
+		errs = append(errs, writeTXTResults(logger, config, results, outDir))
+	}
+
+	if config.OutputFormat == "netcdf" || config.OutputFormat == "both" {
+		filename := outputPath(config, outDir, "results.nc")
+		ncWriter := infrastructure.NewNetCDFFileWriter(logger)
+		if err := ncWriter.WriteResults(filename, results, config); err != nil {
+			errs = append(errs, fmt.Errorf("write %s: %w", filename, err))
+		} else {
+			logger.Info("Successfully written result",
+				zap.String("file", filename))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// outputPath возвращает путь выходного файла с учетом префикса из конфигурации
+func outputPath(config *domain.Config, outDir, name string) string {
+	return filepath.Join(outDir, config.Output.Prefix+name)
+}
+
+// writeTXTResults записывает каждый продукт и его гистограмму в отдельный
+// текстовый файл, а способ усреднения и конфигурацию — в metadata.yaml.
+// Возвращает объединенные ошибки всех файлов, которые не удалось записать.
+func writeTXTResults(logger *zap.Logger, config *domain.Config, results domain.ClassifyResults, outDir string) error {
+	fileWriter := infrastructure.NewTXTFileWriter(logger)
+	var errs []error
+
+	// Каждый продукт записывается в файл <имя>.txt
+	outputFiles := make(map[string]string, len(results))
+	for key := range results {
+		outputFiles[key] = key + ".txt"
+	}
+	// and histograms
+	histOutputFiles := make(map[string]string)
+	for _, key := range config.ComponentProducts() {
+		histOutputFiles[key] = "hist-" + key + ".txt"
+	}
+
+	fmtGf := func(val float64) string {
+		return strconv.FormatFloat(val, 'f', config.DecimalsGf, 64)
+	}
+
+	fmgDefault := func(val float64) string {
+		return strconv.FormatFloat(val, 'f', config.DecimalsDefault, 64)
+	}
+
+	fmtCode := func(val float64) string {
+		return strconv.FormatFloat(val, 'f', 0, 64)
+	}
+
+	var fmtStr infrastructure.FmtFunc
+	for key, name := range outputFiles {
+		filename := outputPath(config, outDir, name)
+		if strings.HasPrefix(key, "GF") {
+			fmtStr = fmtGf
+		} else if key == domain.TypeMapProduct || key == "completed" || key == "converged" || key == "steps" {
+			fmtStr = fmtCode
+		} else {
+			fmtStr = fmgDefault
+		}
+
+		if err := fileWriter.WriteMatrix(filename, results[key], fmtStr); err != nil {
+			errs = append(errs, fmt.Errorf("write %s: %w", filename, err))
+		} else {
+			logger.Info("Successfully written result",
+				zap.String("file", filename))
+		}
+
+	}
+
+	// Способ усреднения и конфигурация, с которыми получены результаты
+	filename := outputPath(config, outDir, "metadata.yaml")
+	if err := fileWriter.WriteMetadata(filename, config); err != nil {
+		errs = append(errs, fmt.Errorf("write %s: %w", filename, err))
+	} else {
+		logger.Info("Successfully written result",
+			zap.String("file", filename))
+	}
+
+	// Легенда карты типов аэрозоля
+	if _, ok := results[domain.TypeMapProduct]; ok {
+		filename := outputPath(config, outDir, domain.TypeMapProduct+"_legend.txt")
+		if err := fileWriter.WriteLegend(filename, config.TypeClasses()); err != nil {
+			errs = append(errs, fmt.Errorf("write %s: %w", filename, err))
+		} else {
+			logger.Info("Successfully written result",
+				zap.String("file", filename))
+		}
+	}
+
+	for key, name := range histOutputFiles {
+		filename := outputPath(config, outDir, name)
+		tmp := results[key]
+		hist, err := tmp.Hist(0, 0, 20)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("calculate histogram for %s: %w", filename, err))
+		} else if err := fileWriter.WriteHistogram(filename, &hist); err != nil {
+			errs = append(errs, fmt.Errorf("write %s: %w", filename, err))
+		} else {
+			logger.Info("Successfully written result",
+				zap.String("file", filename))
+		}
+
+	}
+	return errors.Join(errs...)
+}
+
 func validateMatrixSizes(matrices ...*domain.MatrixData) bool {
 	if len(matrices) < 2 {
 		return true
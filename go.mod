@@ -3,9 +3,13 @@ module lidar-classification
 go 1.24.0
 
 require (
+	github.com/batchatco/go-native-netcdf v0.0.0-20260314195334-c3bf89299976
 	github.com/physicist2018/optimization-go v0.0.4
 	go.uber.org/zap v1.27.1
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require go.uber.org/multierr v1.10.0 // indirect
+require (
+	github.com/batchatco/go-thrower v0.0.0-20200827035905-5cb7337f6be6 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+)
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"lidar-classification/internal/domain"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// InputHash возвращает хеш входных матриц и влияющих на решение параметров
+// конфигурации — тот же, с которым сверяется контрольная точка
+func InputHash(config *domain.Config, depData, flData, mreData *domain.MatrixData, errs domain.MeasurementErrors) (string, error) {
+	return checkpointHash(config, depData, flData, mreData, errs.Dep, errs.FlCap, errs.Mre)
+}
+
+// checkpointHash возвращает хеш входных матриц и параметров конфигурации,
+// влияющих на решение в точках. Параметры ввода-вывода, журнала и
+// диагностики, число воркеров и ограничение времени не учитываются, поэтому
+// их можно менять при продолжении обработки. Seed хранится в контрольной
+// точке отдельно (см. loadCheckpoint). Отсутствующие матрицы (nil) допускаются.
+func checkpointHash(config *domain.Config, matrices ...*domain.MatrixData) (string, error) {
+	c := *config
+	c.Workers, c.Timeout = 0, 0
+	c.Seed = 0
+	c.LogLevel, c.LogFile = "", ""
+	c.GradientCheck = false
+	c.DecimalsDefault, c.DecimalsGf = 0, 0
+	c.Checkpoint, c.Progress = domain.CheckpointConfig{}, domain.ProgressConfig{}
+	c.Trace, c.Dump = domain.TraceConfig{}, domain.DumpConfig{}
+	c.TypeMap = domain.TypeMapConfig{}
+	c.OutputFormat = ""
+	c.Input, c.Output, c.NetCDF = domain.InputFiles{}, domain.OutputDest{}, domain.NetCDFVars{}
+
+	text, err := yaml.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write(text)
+	var buf [8]byte
+	write := func(value uint64) {
+		binary.LittleEndian.PutUint64(buf[:], value)
+		h.Write(buf[:])
+	}
+	for _, m := range matrices {
+		if m == nil {
+			write(0)
+			continue
+		}
+		write(1)
+		write(uint64(m.Rows))
+		write(uint64(m.Cols))
+		for _, row := range m.Data {
+			for _, value := range row {
+				write(math.Float64bits(value))
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadCheckpoint читает сохраненные решения и проверяет, что контрольная точка
+// получена для тех же входных данных и конфигурации. Возвращает решения и
+// seed, с которым они получены: явно заданный seed (не 0) должен совпадать с
+// сохраненным, а при seed = 0 используется сохраненный. Если контрольной точки
+// нет, возвращается пустой список и исходный seed.
+func (c *AerosolClassifier) loadCheckpoint(store domain.CheckpointStore, hash string, seed int64,
+	rows, cols int) ([]domain.ProcessingResult, int64, error) {
+
+	checkpoint, err := store.Load()
+	if errors.Is(err, fs.ErrNotExist) {
+		c.logger.Warn("Checkpoint not found, processing all points")
+		return nil, seed, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("load checkpoint: %w", err)
+	}
+
+	if checkpoint.Hash != hash {
+		return nil, 0, errors.New("checkpoint does not match input data or config")
+	}
+	if seed != 0 && checkpoint.Seed != seed {
+		return nil, 0, fmt.Errorf("checkpoint was created with seed %d, config has seed %d", checkpoint.Seed, seed)
+	}
+	if checkpoint.Rows != rows || checkpoint.Cols != cols {
+		return nil, 0, fmt.Errorf("checkpoint has size %dx%d, expected %dx%d",
+			checkpoint.Rows, checkpoint.Cols, rows, cols)
+	}
+	for _, result := range checkpoint.Results {
+		if result.I < 0 || result.I >= rows || result.J < 0 || result.J >= cols || result.Solution == nil {
+			return nil, 0, fmt.Errorf("checkpoint has invalid point (%d, %d)", result.I, result.J)
+		}
+	}
+
+	c.logger.Info("Resuming from checkpoint",
+		zap.Int("points", len(checkpoint.Results)),
+		zap.Int64("seed", checkpoint.Seed))
+	return checkpoint.Results, checkpoint.Seed, nil
+}
+
+// checkpointer накапливает решения обработанных точек и периодически
+// сохраняет их в хранилище. Методы nil-значения ничего не делают.
+type checkpointer struct {
+	logger     *zap.Logger
+	store      domain.CheckpointStore
+	interval   time.Duration
+	checkpoint domain.Checkpoint
+	lastSave   time.Time
+}
+
+func newCheckpointer(logger *zap.Logger, store domain.CheckpointStore, interval time.Duration,
+	hash string, seed int64, rows, cols int, results []domain.ProcessingResult) *checkpointer {
+
+	return &checkpointer{
+		logger:   logger,
+		store:    store,
+		interval: interval,
+		checkpoint: domain.Checkpoint{
+			Hash:    hash,
+			Rows:    rows,
+			Cols:    cols,
+			Seed:    seed,
+			Results: results,
+		},
+		lastSave: time.Now(),
+	}
+}
+
+// add добавляет решение точки и сохраняет контрольную точку, если с прошлого
+// сохранения прошло не меньше interval. Выборки для записи в файлы dump
+// (SampleRecords) в контрольную точку не входят.
+func (cp *checkpointer) add(result *domain.ProcessingResult) {
+	if cp == nil {
+		return
+	}
+	saved := *result
+	if result.Solution.SampleRecords != nil {
+		solution := *result.Solution
+		solution.SampleRecords = nil
+		saved.Solution = &solution
+	}
+	cp.checkpoint.Results = append(cp.checkpoint.Results, saved)
+	if time.Since(cp.lastSave) >= cp.interval {
+		cp.save()
+	}
+}
+
+// save сохраняет контрольную точку. Ошибка записи не прерывает обработку.
+func (cp *checkpointer) save() {
+	if cp == nil {
+		return
+	}
+	cp.lastSave = time.Now()
+	if err := cp.store.Save(&cp.checkpoint); err != nil {
+		cp.logger.Error("Failed to save checkpoint", zap.Error(err))
+	}
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"lidar-classification/internal/domain"
+)
+
+func TestCheckpointHash(t *testing.T) {
+	dep, fl, mre := testInputs(2, 3)
+	base, err := checkpointHash(testAppConfig(), dep, fl, mre, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(config *domain.Config, dep *domain.MatrixData) []*domain.MatrixData
+		same   bool
+	}{
+		{
+			name: "workers, timeout and seed",
+			change: func(config *domain.Config, dep *domain.MatrixData) []*domain.MatrixData {
+				config.Workers, config.Timeout, config.Seed = 8, time.Hour, 7
+				return []*domain.MatrixData{dep, fl, mre, nil}
+			},
+			same: true,
+		},
+		{
+			name: "output and progress",
+			change: func(config *domain.Config, dep *domain.MatrixData) []*domain.MatrixData {
+				config.Output.Dir, config.Progress.Enabled, config.OutputFormat = "out", true, "netcdf"
+				return []*domain.MatrixData{dep, fl, mre, nil}
+			},
+			same: true,
+		},
+		{
+			name: "epsilon",
+			change: func(config *domain.Config, dep *domain.MatrixData) []*domain.MatrixData {
+				config.Epsilon = 0.2
+				return []*domain.MatrixData{dep, fl, mre, nil}
+			},
+		},
+		{
+			name: "component range",
+			change: func(config *domain.Config, dep *domain.MatrixData) []*domain.MatrixData {
+				config.Components[1].MRange.Max = 1.55
+				return []*domain.MatrixData{dep, fl, mre, nil}
+			},
+		},
+		{
+			name: "input value",
+			change: func(config *domain.Config, dep *domain.MatrixData) []*domain.MatrixData {
+				dep.Data[1][2] = 11
+				return []*domain.MatrixData{dep, fl, mre, nil}
+			},
+		},
+		{
+			name: "uncertainty added",
+			change: func(config *domain.Config, dep *domain.MatrixData) []*domain.MatrixData {
+				return []*domain.MatrixData{dep, fl, mre, newMatrix(2, 3, 1)}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testAppConfig()
+			dep, _, _ := testInputs(2, 3)
+			hash, err := checkpointHash(config, tt.change(config, dep)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (hash == base) != tt.same {
+				t.Errorf("hash changed = %v, want %v", hash != base, !tt.same)
+			}
+		})
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	const hash = "abc"
+	valid := []domain.ProcessingResult{{I: 1, J: 2, Solution: testSolution(0.5)}}
+	checkpoint := func(change func(c *domain.Checkpoint)) *domain.Checkpoint {
+		c := &domain.Checkpoint{Hash: hash, Rows: 2, Cols: 3, Seed: 42, Results: valid}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		checkpoint *domain.Checkpoint
+		seed       int64
+		wantSeed   int64
+		wantPoints int
+		wantErr    string
+	}{
+		{name: "no checkpoint", seed: 7, wantSeed: 7},
+		{name: "seed from checkpoint", checkpoint: checkpoint(nil), wantSeed: 42, wantPoints: 1},
+		{name: "same explicit seed", checkpoint: checkpoint(nil), seed: 42, wantSeed: 42, wantPoints: 1},
+		{name: "different explicit seed", checkpoint: checkpoint(nil), seed: 7, wantErr: "seed 42"},
+		{
+			name:       "hash mismatch",
+			checkpoint: checkpoint(func(c *domain.Checkpoint) { c.Hash = "other" }),
+			wantErr:    "does not match",
+		},
+		{
+			name:       "size mismatch",
+			checkpoint: checkpoint(func(c *domain.Checkpoint) { c.Rows = 3 }),
+			wantErr:    "size 3x3",
+		},
+		{
+			name: "point out of range",
+			checkpoint: checkpoint(func(c *domain.Checkpoint) {
+				c.Results = []domain.ProcessingResult{{I: 2, J: 0, Solution: testSolution(0.5)}}
+			}),
+			wantErr: "invalid point (2, 0)",
+		},
+		{
+			name: "point without solution",
+			checkpoint: checkpoint(func(c *domain.Checkpoint) {
+				c.Results = []domain.ProcessingResult{{I: 0, J: 0}}
+			}),
+			wantErr: "invalid point (0, 0)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewAerosolClassifier(zap.NewNop(), testAppConfig())
+			results, seed, err := c.loadCheckpoint(&memoryStore{checkpoint: tt.checkpoint}, hash, tt.seed, 2, 3)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seed != tt.wantSeed || len(results) != tt.wantPoints {
+				t.Errorf("got %d points with seed %d, want %d with seed %d", len(results), seed, tt.wantPoints, tt.wantSeed)
+			}
+		})
+	}
+}
+
+// TestCheckpointerOmitsSampleRecords проверяет, что выборки для dump не
+// сохраняются в контрольной точке и не удаляются из решения точки
+func TestCheckpointerOmitsSampleRecords(t *testing.T) {
+	store := &memoryStore{}
+	saver := newCheckpointer(zap.NewNop(), store, 0, "abc", 1, 2, 3, nil)
+	solution := testSolution(0.5)
+	solution.SampleRecords = []domain.SampleRecord{{Attempt: 1}, {Attempt: 2}}
+
+	saver.add(&domain.ProcessingResult{I: 0, J: 1, Solution: solution})
+	if store.checkpoint == nil || len(store.checkpoint.Results) != 1 {
+		t.Fatal("checkpoint not saved")
+	}
+	if records := store.checkpoint.Results[0].Solution.SampleRecords; records != nil {
+		t.Errorf("checkpoint stores %d sample records", len(records))
+	}
+	if len(solution.SampleRecords) != 2 {
+		t.Error("sample records removed from the solution")
+	}
+}
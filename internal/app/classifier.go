@@ -1,60 +1,161 @@
 package app
 
 import (
+	"context"
+	"fmt"
 	"lidar-classification/internal/domain"
 	"lidar-classification/pkg/optimization"
 	"math"
+	"strconv"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
 type AerosolClassifier struct {
 	logger    *zap.Logger
-	optimizer *optimization.MonteCarloOptimizer
+	optimizer domain.PointSolver
 	config    *domain.Config
 }
 
 func NewAerosolClassifier(logger *zap.Logger, config *domain.Config) *AerosolClassifier {
+	var solver domain.PointSolver = optimization.NewMonteCarloOptimizer(logger)
+	if config.GetMode() == domain.ModeMCMC {
+		solver = optimization.NewMCMCSampler(logger)
+	}
 	return &AerosolClassifier{
 		logger:    logger,
-		optimizer: optimization.NewMonteCarloOptimizer(logger),
+		optimizer: solver,
 		config:    config,
 	}
 }
 
-func (c *AerosolClassifier) ProcessMatrices(depData, flData, mreData *domain.MatrixData) domain.ClassifyResults {
+// ProcessOptions — необязательные получатели данных обработки (nil — не используется)
+type ProcessOptions struct {
+	// Checkpoint — хранилище контрольной точки: решения обработанных точек
+	// периодически сохраняются, а при checkpoint.resume обработка продолжается с нее
+	Checkpoint domain.CheckpointStore
+	// Progress — вывод хода обработки
+	Progress domain.ProgressReporter
+	// Dump — запись всех выборок точек, выбранных в секции dump конфигурации
+	Dump domain.SampleDumpWriter
+}
+
+// ProcessMatrices выполняет классификацию для всех точек матриц. Матрицы
+// погрешностей errs необязательны и используются как веса в функции стоимости.
+//
+// При отмене ctx (сигнал или истечение времени) новые точки не отправляются
+// воркерам, уже начатые точки досчитываются. Возвращаются частично заполненные
+// результаты, маска обработанных точек (1 — точка обработана, 0 — нет) и
+// ошибка ctx.Err(), если обработаны не все точки.
+//
+// Seed = 0 в конфигурации заменяется сохраненным в контрольной точке при
+// продолжении обработки, иначе — значением от текущего времени. Возвращается
+// seed, с которым фактически получены результаты.
+//
+// Если контрольную точку из opts.Checkpoint нельзя использовать, результаты
+// не возвращаются. Контрольная точка не удаляется: после записи результатов
+// ее удаляет вызывающий код (opts.Checkpoint.Remove).
+func (c *AerosolClassifier) ProcessMatrices(ctx context.Context, depData, flData, mreData *domain.MatrixData,
+	errs domain.MeasurementErrors, opts ProcessOptions) (domain.ClassifyResults, *domain.MatrixData, int64, error) {
+
 	results := c.initializeResultMatrices(depData.Rows, depData.Cols)
+	completed := newMatrix(depData.Rows, depData.Cols, 0)
+
+	// Точки, все выборки которых записываются в файлы
+	var dumpPoints map[[2]int]bool
+	if opts.Dump != nil {
+		dumpPoints = c.dumpPoints(depData)
+	}
+	writeSamples := func(result *domain.ProcessingResult) {
+		if opts.Dump != nil && result.Solution.SampleRecords != nil {
+			data := c.preparePointData(result.I, result.J, depData, flData, mreData, errs)
+			c.writeSamples(opts.Dump, data, depData, result.Solution)
+		}
+	}
+
+	config := c.config
+	seed := config.Seed
+	var hash string
+	var saved []domain.ProcessingResult
+	if store := opts.Checkpoint; store != nil {
+		var err error
+		if hash, err = InputHash(config, depData, flData, mreData, errs); err != nil {
+			return nil, nil, 0, fmt.Errorf("checkpoint hash: %w", err)
+		}
+		if config.Checkpoint.Resume {
+			if saved, seed, err = c.loadCheckpoint(store, hash, seed, depData.Rows, depData.Cols); err != nil {
+				return nil, nil, 0, err
+			}
+		}
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+		c.logger.Info("Random seed is not set, using current time", zap.Int64("seed", seed))
+	}
+	if seed != config.Seed {
+		resolved := *config
+		resolved.Seed = seed
+		config = &resolved
+	}
+
+	var saver *checkpointer
+	if store := opts.Checkpoint; store != nil {
+		for k := range saved {
+			c.applyResult(results, completed, &saved[k])
+			writeSamples(&saved[k])
+		}
+		saver = newCheckpointer(c.logger, store, config.Checkpoint.Interval, hash, seed, depData.Rows, depData.Cols, saved)
+	}
+
+	// Точки с некорректными входными данными не требуют расчета и считаются обработанными
+	var tasks []domain.ProcessingTask
+	for i := range depData.Rows {
+		for j := range depData.Cols {
+			if completed.Data[i][j] == 1 {
+				continue
+			}
+			pointData := c.preparePointData(i, j, depData, flData, mreData, errs)
+			if !c.validatePointData(pointData) {
+				if dumpPoints[[2]int{i, j}] {
+					c.logger.Warn("Point selected for sample dump has invalid input data", zap.Int("i", i), zap.Int("j", j))
+				}
+				completed.Data[i][j] = 1
+				continue
+			}
+			pointData.Dump = dumpPoints[[2]int{i, j}]
+			tasks = append(tasks, domain.ProcessingTask{
+				I:      i,
+				J:      j,
+				Data:   pointData,
+				Config: config,
+			})
+		}
+	}
 
 	var wg sync.WaitGroup
 	taskChan := make(chan domain.ProcessingTask, c.config.Workers*2)
-	resultChan := make(chan *domain.ProcessingResult, depData.Rows*depData.Cols)
+	resultChan := make(chan *domain.ProcessingResult, len(tasks))
 
 	// Запускаем воркеры
 	for i := range c.config.Workers {
 		wg.Add(1)
 		c.logger.Info("Starting worker", zap.Int("id", i))
-		go c.worker(i, taskChan, resultChan, &wg)
+		go c.worker(ctx, i, taskChan, resultChan, &wg)
 	}
 
-	// Отправляем задачи
+	// Отправляем задачи, пока контекст не отменен
 	go func() {
-		for i := range depData.Rows {
-			for j := range depData.Cols {
-				pointData := c.preparePointData(i, j, depData, flData, mreData)
-				if c.validatePointData(pointData) {
-					task := domain.ProcessingTask{
-						I:      i,
-						J:      j,
-						Data:   pointData,
-						Config: c.config,
-						Result: resultChan,
-					}
-					taskChan <- task
-				}
+		defer close(taskChan)
+		for _, task := range tasks {
+			task.Result = resultChan
+			select {
+			case taskChan <- task:
+			case <-ctx.Done():
+				return
 			}
 		}
-		close(taskChan)
 	}()
 
 	// Собираем результаты
@@ -64,19 +165,60 @@ func (c *AerosolClassifier) ProcessMatrices(depData, flData, mreData *domain.Mat
 	}()
 
 	// Обрабатываем результаты
+	progress := opts.Progress
+	if progress != nil {
+		progress.Start(len(tasks))
+	}
+	done := 0
 	for result := range resultChan {
-		if result.Solution.IsValid {
-			c.updateResults(results, result)
+		done++
+		c.applyResult(results, completed, result)
+		writeSamples(result)
+		saver.add(result)
+		if progress != nil {
+			progress.Add(result.Solution.IsValid)
 		}
 	}
+	if progress != nil {
+		progress.Finish()
+	}
+
+	if c.config.TypeMap.Enabled {
+		results[domain.TypeMapProduct] = DominantTypeMap(results, c.config)
+	}
+
+	// Контрольная точка сохраняется и после обработки всех точек: ее удаляет
+	// вызывающий код после записи результатов, чтобы при ошибке записи
+	// обработку можно было продолжить без повторного расчета
+	saver.save()
+	if done < len(tasks) {
+		return results, completed, seed, ctx.Err()
+	}
+	return results, completed, seed, nil
+}
 
-	return results
+// applyResult записывает решение точки в результаты и отмечает точку как обработанную
+func (c *AerosolClassifier) applyResult(results domain.ClassifyResults, completed *domain.MatrixData, result *domain.ProcessingResult) {
+	completed.Data[result.I][result.J] = 1
+	if samples, ok := results["samples"]; ok {
+		// Число выборок записывается и для точек без решения
+		samples.Data[result.I][result.J] = float64(result.Solution.Samples)
+	}
+	if result.Solution.IsValid {
+		c.updateResults(results, result)
+	}
 }
 
-func (c *AerosolClassifier) worker(id int, tasks <-chan domain.ProcessingTask, results chan<- *domain.ProcessingResult, wg *sync.WaitGroup) {
+// worker решает задачи из канала tasks. После отмены ctx оставшиеся в канале
+// задачи пропускаются.
+func (c *AerosolClassifier) worker(ctx context.Context, id int, tasks <-chan domain.ProcessingTask, results chan<- *domain.ProcessingResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for task := range tasks {
+		if ctx.Err() != nil {
+			continue
+		}
+
 		c.logger.Debug("Processing point",
 			zap.Int("worker", id),
 			zap.Int("i", task.I),
@@ -92,75 +234,146 @@ func (c *AerosolClassifier) worker(id int, tasks <-chan domain.ProcessingTask, r
 	}
 }
 
-func (c *AerosolClassifier) preparePointData(i, j int, dep, fl, mre *domain.MatrixData) *domain.PointData {
+func (c *AerosolClassifier) preparePointData(i, j int, dep, fl, mre *domain.MatrixData, errs domain.MeasurementErrors) *domain.PointData {
 	delta := dep.Data[i][j] / 100.0 // Конвертируем проценты
 	deltaPrime := delta / (1 + delta)
 
+	// Погрешность delta' = delta/(1+delta): sigma' = sigma/(1+delta)^2
+	deltaPrimeErr := errorAt(errs.Dep, i, j) / 100.0 / ((1 + delta) * (1 + delta))
+
 	return &domain.PointData{
-		I:          i,
-		J:          j,
-		DeltaPrime: deltaPrime,
-		Gf:         fl.Data[i][j],
-		M:          mre.Data[i][j],
+		I:             i,
+		J:             j,
+		DeltaPrime:    deltaPrime,
+		Gf:            fl.Data[i][j],
+		M:             mre.Data[i][j],
+		DeltaPrimeErr: deltaPrimeErr,
+		GfErr:         errorAt(errs.FlCap, i, j),
+		MErr:          errorAt(errs.Mre, i, j),
 	}
 }
 
+// errorAt возвращает погрешность в точке или NaN, если она не задана или не положительна
+func errorAt(m *domain.MatrixData, i, j int) float64 {
+	if m == nil || m.Data[i][j] <= 0 {
+		return math.NaN()
+	}
+	return m.Data[i][j]
+}
+
 func (c *AerosolClassifier) validatePointData(data *domain.PointData) bool {
 	return (!math.IsNaN(data.DeltaPrime) && !math.IsNaN(data.Gf) && !math.IsNaN(data.M)) &&
 		data.DeltaPrime > 0 && data.Gf > 0 && data.M > 0
 }
 
+// spreadSuffixes возвращает суффиксы продуктов разброса по ансамблю: _std и,
+// если включено в конфигурации, процентили (_p16, _p50, _p84).
+func (c *AerosolClassifier) spreadSuffixes() []string {
+	suffixes := []string{"_std"}
+	if c.config.Percentiles {
+		for _, level := range domain.PercentileLevels {
+			suffixes = append(suffixes, "_p"+strconv.FormatFloat(level, 'f', -1, 64))
+		}
+	}
+	return suffixes
+}
+
+// diagnosticProducts — продукты диагностики сходимости в режиме mcmc
+var diagnosticProducts = []string{"acceptance", "rhat", "ess", "converged", "steps"}
+
 func (c *AerosolClassifier) initializeResultMatrices(rows, cols int) domain.ClassifyResults {
 	matrices := make(domain.ClassifyResults)
-	outputFiles := []string{
-		"residuals", "n_d", "n_u", "n_s", "n_w",
-		"GF_d", "GF_u", "GF_s", "GF_w",
-		"delta_d", "delta_u", "delta_s", "delta_w",
-		"mre_d", "mre_u", "mre_s", "mre_w",
-		"diff_eq1", "diff_eq2", "diff_eq3", "diff_eq4",
+	typeProducts := c.config.ComponentProducts()
+	outputFiles := []string{"residuals"}
+	outputFiles = append(outputFiles, typeProducts...)
+	outputFiles = append(outputFiles, "diff_eq1", "diff_eq2", "diff_eq3", "diff_eq4")
+	for _, suffix := range c.spreadSuffixes() {
+		for _, name := range typeProducts {
+			outputFiles = append(outputFiles, name+suffix)
+		}
+	}
+	if c.config.GetMode() == domain.ModeMCMC {
+		outputFiles = append(outputFiles, diagnosticProducts...)
+	} else if c.config.Adaptive.Enabled {
+		outputFiles = append(outputFiles, "samples")
 	}
 
 	for _, name := range outputFiles {
-		data := make([][]float64, rows)
-		for i := range data {
-			data[i] = make([]float64, cols)
-			for j := range data[i] {
-				data[i][j] = math.NaN() // Значение для необработанных точек
-			}
-		}
-		matrices[name] = &domain.MatrixData{
-			Data: data,
-			Rows: rows,
-			Cols: cols,
-		}
+		matrices[name] = newMatrix(rows, cols, math.NaN()) // NaN — значение для необработанных точек
 	}
 	return matrices
 }
 
+// newMatrix создает матрицу rows x cols, заполненную значением value
+func newMatrix(rows, cols int, value float64) *domain.MatrixData {
+	data := make([][]float64, rows)
+	for i := range data {
+		data[i] = make([]float64, cols)
+		for j := range data[i] {
+			data[i][j] = value
+		}
+	}
+	return &domain.MatrixData{
+		Data: data,
+		Rows: rows,
+		Cols: cols,
+	}
+}
+
 func (c *AerosolClassifier) updateResults(results map[string]*domain.MatrixData, result *domain.ProcessingResult) {
 	i, j := result.I, result.J
 	sol := result.Solution
 
 	results["residuals"].Data[i][j] = sol.Residual
-	results["n_d"].Data[i][j] = sol.Fractions.D
-	results["n_u"].Data[i][j] = sol.Fractions.U
-	results["n_s"].Data[i][j] = sol.Fractions.S
-	results["n_w"].Data[i][j] = sol.Fractions.W
-	results["GF_d"].Data[i][j] = sol.Parameters.GfD
-	results["GF_u"].Data[i][j] = sol.Parameters.GfU
-	results["GF_s"].Data[i][j] = sol.Parameters.GfS
-	results["GF_w"].Data[i][j] = sol.Parameters.GfW
-	results["delta_d"].Data[i][j] = sol.Parameters.DeltaDPrime / (1 - sol.Parameters.DeltaDPrime)
-	results["delta_u"].Data[i][j] = sol.Parameters.DeltaUPrime / (1 - sol.Parameters.DeltaUPrime)
-	results["delta_s"].Data[i][j] = sol.Parameters.DeltaSPrime / (1 - sol.Parameters.DeltaSPrime)
-	results["delta_w"].Data[i][j] = sol.Parameters.DeltaWPrime / (1 - sol.Parameters.DeltaWPrime)
-	results["mre_d"].Data[i][j] = sol.Parameters.MreD
-	results["mre_u"].Data[i][j] = sol.Parameters.MreU
-	results["mre_s"].Data[i][j] = sol.Parameters.MreS
-	results["mre_w"].Data[i][j] = sol.Parameters.MreW
+	c.setTypeProducts(results, i, j, "", sol.Fractions, sol.Parameters, deltaFromPrime(sol.Parameters))
 	results["diff_eq1"].Data[i][j] = sol.Difference[0]
 	results["diff_eq2"].Data[i][j] = sol.Difference[1]
 	results["diff_eq3"].Data[i][j] = sol.Difference[2]
 	results["diff_eq4"].Data[i][j] = sol.Difference[3]
 
+	// Разброс деполяризации пересчитывается из штрихованной величины линеаризацией
+	// d(delta)/d(delta') = 1/(1-delta')^2
+	deltaStd := make([]float64, len(sol.ParametersStd))
+	for k, std := range sol.ParametersStd {
+		deltaStd[k] = std.DeltaPrime / math.Pow(1-sol.Parameters[k].DeltaPrime, 2)
+	}
+	c.setTypeProducts(results, i, j, "_std", sol.FractionsStd, sol.ParametersStd, deltaStd)
+
+	for _, pct := range sol.Percentiles {
+		suffix := "_p" + strconv.FormatFloat(pct.Level, 'f', -1, 64)
+		c.setTypeProducts(results, i, j, suffix, pct.Fractions, pct.Parameters, deltaFromPrime(pct.Parameters))
+	}
+
+	if diag := sol.Diagnostics; diag != nil {
+		results["acceptance"].Data[i][j] = diag.Acceptance
+		results["rhat"].Data[i][j] = diag.RHat
+		results["ess"].Data[i][j] = diag.ESS
+		results["steps"].Data[i][j] = float64(diag.Steps)
+		results["converged"].Data[i][j] = 0
+		if diag.Converged {
+			results["converged"].Data[i][j] = 1
+		}
+	}
+}
+
+// setTypeProducts записывает доли и параметры компонент в продукты с суффиксом suffix.
+// delta — деполяризация компонент (не штрихованная).
+func (c *AerosolClassifier) setTypeProducts(results map[string]*domain.MatrixData, i, j int, suffix string,
+	f domain.Fractions, p domain.Parameters, delta []float64) {
+
+	for k, comp := range c.config.Components {
+		results["n_"+comp.Name+suffix].Data[i][j] = f[k]
+		results["GF_"+comp.Name+suffix].Data[i][j] = p[k].Gf
+		results["delta_"+comp.Name+suffix].Data[i][j] = delta[k]
+		results["mre_"+comp.Name+suffix].Data[i][j] = p[k].Mre
+	}
+}
+
+// deltaFromPrime пересчитывает штрихованную деполяризацию delta' = delta/(1+delta) в delta
+func deltaFromPrime(p domain.Parameters) []float64 {
+	delta := make([]float64, len(p))
+	for k, cp := range p {
+		delta[k] = cp.DeltaPrime / (1 - cp.DeltaPrime)
+	}
+	return delta
 }
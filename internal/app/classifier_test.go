@@ -0,0 +1,245 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"lidar-classification/internal/domain"
+)
+
+// testAppConfig возвращает конфигурацию с двумя компонентами
+func testAppConfig() *domain.Config {
+	uniform := func(min, max float64) domain.Prior {
+		return domain.Prior{Dist: domain.DistUniform, Min: min, Max: max}
+	}
+	return &domain.Config{
+		Components: []domain.Component{
+			{Name: "d", LR: 49, CV: 0.07, GfRange: uniform(1e-5, 1e-4), MRange: uniform(1.40, 1.45), DeltaRange: uniform(0.20, 0.35)},
+			{Name: "s", LR: 65, CV: 0.085, GfRange: uniform(2e-4, 1e-3), MRange: uniform(1.51, 1.54), DeltaRange: uniform(0.01, 0.10)},
+		},
+		NSamples:   20,
+		N1:         5,
+		Epsilon:    0.1,
+		Workers:    2,
+		Checkpoint: domain.CheckpointConfig{Enabled: true, Interval: time.Hour},
+	}
+}
+
+// testInputs возвращает входные матрицы rows x cols с допустимыми значениями
+func testInputs(rows, cols int) (dep, fl, mre *domain.MatrixData) {
+	dep, fl, mre = newMatrix(rows, cols, 10), newMatrix(rows, cols, 2e-4), newMatrix(rows, cols, 1.47)
+	for _, m := range []*domain.MatrixData{dep, fl, mre} {
+		m.HeightLabels = make([]float64, rows)
+		for i := range rows {
+			m.HeightLabels[i] = 500 + 100*float64(i)
+		}
+		m.TimeLabels = make([]string, cols)
+		for j := range cols {
+			m.TimeLabels[j] = strconv.Itoa(600 * j)
+		}
+	}
+	return dep, fl, mre
+}
+
+// testSolution возвращает решение с долей первой компоненты nd
+func testSolution(nd float64) *domain.Solution {
+	params := domain.Parameters{
+		{Gf: 5e-5, DeltaPrime: 0.2, Mre: 1.42},
+		{Gf: 5e-4, DeltaPrime: 0.05, Mre: 1.52},
+	}
+	return &domain.Solution{
+		Residual:      0.01,
+		Fractions:     domain.Fractions{nd, 1 - nd},
+		Parameters:    params,
+		IsValid:       true,
+		Difference:    make([]float64, 4),
+		FractionsStd:  domain.Fractions{0, 0},
+		ParametersStd: make(domain.Parameters, len(params)),
+	}
+}
+
+// fakeSolver возвращает testSolution(nd) и запоминает seed, с которым решалась каждая точка.
+// Если задан onSolve, он вызывается перед возвратом решения.
+type fakeSolver struct {
+	nd      float64
+	onSolve func(data *domain.PointData)
+
+	mu     sync.Mutex
+	solved map[[2]int]int64
+}
+
+func (s *fakeSolver) Solve(data *domain.PointData, config *domain.Config) *domain.Solution {
+	s.mu.Lock()
+	if s.solved == nil {
+		s.solved = make(map[[2]int]int64)
+	}
+	s.solved[[2]int{data.I, data.J}] = config.Seed
+	s.mu.Unlock()
+	if s.onSolve != nil {
+		s.onSolve(data)
+	}
+	return testSolution(s.nd)
+}
+
+// memoryStore хранит контрольную точку в памяти
+type memoryStore struct {
+	checkpoint *domain.Checkpoint
+	removed    bool
+}
+
+func (s *memoryStore) Load() (*domain.Checkpoint, error) {
+	if s.checkpoint == nil {
+		return nil, fs.ErrNotExist
+	}
+	checkpoint := *s.checkpoint
+	checkpoint.Results = append([]domain.ProcessingResult(nil), s.checkpoint.Results...)
+	return &checkpoint, nil
+}
+
+func (s *memoryStore) Save(checkpoint *domain.Checkpoint) error {
+	saved := *checkpoint
+	saved.Results = append([]domain.ProcessingResult(nil), checkpoint.Results...)
+	s.checkpoint = &saved
+	return nil
+}
+
+func (s *memoryStore) Remove() error {
+	s.checkpoint = nil
+	s.removed = true
+	return nil
+}
+
+// newTestClassifier создает классификатор с решателем solver
+func newTestClassifier(config *domain.Config, solver domain.PointSolver) *AerosolClassifier {
+	c := NewAerosolClassifier(zap.NewNop(), config)
+	c.optimizer = solver
+	return c
+}
+
+// TestProcessMatricesResume проверяет, что при продолжении точки из контрольной
+// точки не пересчитываются, используется сохраненный seed, а контрольная
+// точка с решениями всех точек остается для удаления после записи результатов
+func TestProcessMatricesResume(t *testing.T) {
+	config := testAppConfig()
+	config.Checkpoint.Resume = true
+	dep, fl, mre := testInputs(2, 3)
+	hash, err := InputHash(config, dep, fl, mre, domain.MeasurementErrors{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const seed = 42
+	saved := []domain.ProcessingResult{
+		{I: 0, J: 1, Solution: testSolution(0.9)},
+		{I: 1, J: 2, Solution: &domain.Solution{IsValid: false}},
+	}
+	store := &memoryStore{checkpoint: &domain.Checkpoint{Hash: hash, Rows: 2, Cols: 3, Seed: seed, Results: saved}}
+	solver := &fakeSolver{nd: 0.25}
+
+	results, completed, gotSeed, err := newTestClassifier(config, solver).ProcessMatrices(
+		context.Background(), dep, fl, mre, domain.MeasurementErrors{}, ProcessOptions{Checkpoint: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotSeed != seed {
+		t.Errorf("seed = %d, want %d from checkpoint", gotSeed, seed)
+	}
+
+	if len(solver.solved) != 4 {
+		t.Errorf("solved %d points, want 4 remaining", len(solver.solved))
+	}
+	for point, pointSeed := range solver.solved {
+		if point == [2]int{0, 1} || point == [2]int{1, 2} {
+			t.Errorf("point %v from checkpoint was solved again", point)
+		}
+		if pointSeed != seed {
+			t.Errorf("point %v solved with seed %d, want %d", point, pointSeed, seed)
+		}
+	}
+
+	nd := results["n_d"].Data
+	if nd[0][1] != 0.9 || nd[0][0] != 0.25 || !math.IsNaN(nd[1][2]) {
+		t.Errorf("n_d = %v, want 0.9 at (0, 1) from checkpoint, NaN at (1, 2), 0.25 elsewhere", nd)
+	}
+	if countOnes(completed) != 6 {
+		t.Errorf("completed = %v, want all points", completed.Data)
+	}
+
+	if store.removed || store.checkpoint == nil {
+		t.Fatal("checkpoint removed before results are written")
+	}
+	if len(store.checkpoint.Results) != 6 || store.checkpoint.Seed != seed {
+		t.Errorf("saved checkpoint has %d points and seed %d, want 6 and %d",
+			len(store.checkpoint.Results), store.checkpoint.Seed, seed)
+	}
+}
+
+// TestProcessMatricesCancel проверяет, что после отмены контекста новые точки
+// не решаются, а возвращаются частичные результаты, маска обработанных точек
+// и сохраненная контрольная точка
+func TestProcessMatricesCancel(t *testing.T) {
+	config := testAppConfig()
+	config.Workers = 1
+	dep, fl, mre := testInputs(3, 4)
+	// Точка с некорректными данными не решается и сразу считается обработанной
+	dep.Data[2][3] = math.NaN()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	solver := &fakeSolver{nd: 0.25, onSolve: func(*domain.PointData) { cancel() }}
+	store := &memoryStore{}
+
+	results, completed, _, err := newTestClassifier(config, solver).ProcessMatrices(
+		ctx, dep, fl, mre, domain.MeasurementErrors{}, ProcessOptions{Checkpoint: store})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if results == nil || completed == nil {
+		t.Fatal("partial results not returned")
+	}
+
+	if len(solver.solved) != 1 {
+		t.Fatalf("solved %d points after cancellation, want 1", len(solver.solved))
+	}
+	var solved [2]int
+	for point := range solver.solved {
+		solved = point
+	}
+	for i := range 3 {
+		for j := range 4 {
+			done := [2]int{i, j} == solved || (i == 2 && j == 3)
+			if (completed.Data[i][j] == 1) != done {
+				t.Errorf("completed[%d][%d] = %g, want %v", i, j, completed.Data[i][j], done)
+			}
+			nd := results["n_d"].Data[i][j]
+			if [2]int{i, j} == solved && nd != 0.25 || [2]int{i, j} != solved && !math.IsNaN(nd) {
+				t.Errorf("n_d[%d][%d] = %g", i, j, nd)
+			}
+		}
+	}
+
+	if store.checkpoint == nil || len(store.checkpoint.Results) != 1 {
+		t.Error("checkpoint with the solved point not saved on cancellation")
+	}
+}
+
+// countOnes возвращает число элементов маски, равных 1
+func countOnes(m *domain.MatrixData) int {
+	count := 0
+	for _, row := range m.Data {
+		for _, v := range row {
+			if v == 1 {
+				count++
+			}
+		}
+	}
+	return count
+}
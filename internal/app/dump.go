@@ -0,0 +1,101 @@
+package app
+
+import (
+	"lidar-classification/internal/domain"
+	"math"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// dumpPoints возвращает индексы точек из секции dump конфигурации. Точки,
+// заданные метками, ищутся среди меток матрицы labels: ближайшая высота и
+// совпадающая метка времени. Точки вне матрицы пропускаются с предупреждением.
+func (c *AerosolClassifier) dumpPoints(labels *domain.MatrixData) map[[2]int]bool {
+	points := make(map[[2]int]bool)
+	for _, p := range c.config.Dump.Points {
+		if p[0] >= labels.Rows || p[1] >= labels.Cols {
+			c.logger.Warn("Point selected for sample dump is out of range",
+				zap.Int("i", p[0]),
+				zap.Int("j", p[1]),
+				zap.Int("rows", labels.Rows),
+				zap.Int("cols", labels.Cols))
+			continue
+		}
+		points[p] = true
+	}
+
+	for _, label := range c.config.Dump.Labels {
+		i := nearestIndex(labels.HeightLabels, label.Altitude)
+		j := timeLabelIndex(labels.TimeLabels, label.Time)
+		if i < 0 || j < 0 {
+			c.logger.Warn("Point selected for sample dump is not found",
+				zap.Float64("altitude", label.Altitude),
+				zap.String("time", label.Time))
+			continue
+		}
+		c.logger.Info("Point selected for sample dump",
+			zap.Float64("altitude", labels.HeightLabels[i]),
+			zap.String("time", labels.TimeLabels[j]),
+			zap.Int("i", i),
+			zap.Int("j", j))
+		points[[2]int{i, j}] = true
+	}
+	return points
+}
+
+// nearestIndex возвращает индекс значения из values, ближайшего к value,
+// или -1, если values пуст
+func nearestIndex(values []float64, value float64) int {
+	best := -1
+	for k, v := range values {
+		if best < 0 || math.Abs(v-value) < math.Abs(values[best]-value) {
+			best = k
+		}
+	}
+	return best
+}
+
+// timeLabelIndex возвращает индекс метки времени, совпадающей с label, или -1.
+// Если совпадения нет, числовые метки сравниваются как числа ("12.5" и "12.50").
+func timeLabelIndex(labels []string, label string) int {
+	for k, l := range labels {
+		if l == label {
+			return k
+		}
+	}
+	value, err := strconv.ParseFloat(label, 64)
+	if err != nil {
+		return -1
+	}
+	for k, l := range labels {
+		if v, err := strconv.ParseFloat(l, 64); err == nil && v == value {
+			return k
+		}
+	}
+	return -1
+}
+
+// writeSamples записывает все выборки точки вместе с ее измерениями и метками
+func (c *AerosolClassifier) writeSamples(writer domain.SampleDumpWriter, data *domain.PointData,
+	labels *domain.MatrixData, sol *domain.Solution) {
+
+	dump := &domain.SampleDump{
+		Data:     *data,
+		Altitude: math.NaN(),
+		Samples:  sol.SampleRecords,
+	}
+	if data.I < len(labels.HeightLabels) {
+		dump.Altitude = labels.HeightLabels[data.I]
+	}
+	if data.J < len(labels.TimeLabels) {
+		dump.Time = labels.TimeLabels[data.J]
+	}
+
+	if err := writer.WriteSamples(dump); err != nil {
+		c.logger.Error("Failed to write samples",
+			zap.Int("i", data.I),
+			zap.Int("j", data.J),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"lidar-classification/internal/domain"
+	"math"
+)
+
+// DominantTypeMap строит по долям компонент (продукты n_<name>) матрицу кодов
+// преобладающего типа аэрозоля (см. domain.Config.TypeClasses). Компонента
+// преобладает, если ее доля не меньше порога и превышает следующую по величине
+// долю не меньше чем на mixed_margin; иначе, в том числе при равных наибольших
+// долях, точка относится к смеси. Точки без решения не классифицируются.
+func DominantTypeMap(results domain.ClassifyResults, config *domain.Config) *domain.MatrixData {
+	fractions := make([]*domain.MatrixData, len(config.Components))
+	for k, comp := range config.Components {
+		fractions[k] = results["n_"+comp.Name]
+	}
+	rows, cols := fractions[0].Rows, fractions[0].Cols
+	settings := config.TypeMap
+
+	data := make([][]float64, rows)
+	for i := range data {
+		data[i] = make([]float64, cols)
+		for j := range data[i] {
+			data[i][j] = float64(dominantType(fractions, i, j, config.Components, settings, config.TypeMixedCode()))
+		}
+	}
+
+	return &domain.MatrixData{
+		HeightLabels: fractions[0].HeightLabels,
+		TimeLabels:   fractions[0].TimeLabels,
+		Data:         data,
+		Rows:         rows,
+		Cols:         cols,
+	}
+}
+
+// dominantType возвращает код типа аэрозоля в точке (i, j)
+func dominantType(fractions []*domain.MatrixData, i, j int, components []domain.Component,
+	settings domain.TypeMapConfig, mixedCode int) int {
+
+	best, first, second := -1, math.Inf(-1), math.Inf(-1)
+	for k, m := range fractions {
+		f := m.Data[i][j]
+		if math.IsNaN(f) {
+			return domain.TypeUnclassified
+		}
+		if f > first {
+			best, first, second = k, f, first
+		} else if f > second {
+			second = f
+		}
+	}
+
+	// При равных наибольших долях (возможно при mixed_margin = 0) ни одна компонента не преобладает
+	if first < settings.Threshold(components[best].Name) || first-second < settings.MixedMargin || first == second {
+		return mixedCode
+	}
+	return best + 1
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"math"
+	"testing"
+
+	"lidar-classification/internal/domain"
+)
+
+func TestDominantTypeMap(t *testing.T) {
+	nan := math.NaN()
+	// Доли компонент d и s в точках (0, j)
+	nd := []float64{0.7, 0.2, 0.55, 0.5, 0.5, 0.1, nan}
+	ns := []float64{0.3, 0.8, 0.45, 0.5, 0.5, 0.8, nan}
+	const mixed = 3
+
+	tests := []struct {
+		name     string
+		settings domain.TypeMapConfig
+		want     []float64
+	}{
+		{
+			name:     "dominance and margin",
+			settings: domain.TypeMapConfig{Dominance: 0.5, MixedMargin: 0.2},
+			want:     []float64{1, 2, mixed, mixed, mixed, 2, domain.TypeUnclassified},
+		},
+		{
+			name:     "zero margin with ties",
+			settings: domain.TypeMapConfig{Dominance: 0.5},
+			want:     []float64{1, 2, 1, mixed, mixed, 2, domain.TypeUnclassified},
+		},
+		{
+			name:     "component threshold",
+			settings: domain.TypeMapConfig{Dominance: 0.5, Thresholds: map[string]float64{"s": 0.85}},
+			want:     []float64{1, mixed, 1, mixed, mixed, mixed, domain.TypeUnclassified},
+		},
+		{
+			// Сумма долей меньше 1: наибольшая доля ниже порога
+			name:     "below dominance",
+			settings: domain.TypeMapConfig{Dominance: 0.75},
+			want:     []float64{mixed, 2, mixed, mixed, mixed, 2, domain.TypeUnclassified},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testAppConfig()
+			config.TypeMap = tt.settings
+			results := domain.ClassifyResults{
+				"n_d": {Data: [][]float64{nd}, Rows: 1, Cols: len(nd), TimeLabels: []string{"a"}},
+				"n_s": {Data: [][]float64{ns}, Rows: 1, Cols: len(ns)},
+			}
+
+			got := DominantTypeMap(results, config)
+			if got.Rows != 1 || got.Cols != len(nd) || len(got.TimeLabels) != 1 {
+				t.Fatalf("size %dx%d with labels %v, want 1x%d with labels of n_d", got.Rows, got.Cols, got.TimeLabels, len(nd))
+			}
+			for j, want := range tt.want {
+				if got.Data[0][j] != want {
+					t.Errorf("n_d = %g, n_s = %g: code %g, want %g", nd[j], ns[j], got.Data[0][j], want)
+				}
+			}
+		})
+	}
+}
+
+func TestTypeClasses(t *testing.T) {
+	config := testAppConfig()
+	config.Components[0].LongName = "desert dust"
+
+	want := []domain.TypeClass{
+		{Code: 0, Name: "unclassified", Description: "no solution"},
+		{Code: 1, Name: "desert_dust_dominated", Description: "desert dust dominated"},
+		{Code: 2, Name: "s_dominated", Description: "s dominated"},
+		{Code: 3, Name: "mixed", Description: "no dominant type"},
+	}
+	got := config.TypeClasses()
+	if len(got) != len(want) {
+		t.Fatalf("classes = %v, want %v", got, want)
+	}
+	for k := range want {
+		if got[k] != want[k] {
+			t.Errorf("class %d = %+v, want %+v", k, got[k], want[k])
+		}
+	}
+	if config.TypeMixedCode() != 3 {
+		t.Errorf("mixed code = %d, want 3", config.TypeMixedCode())
+	}
+}
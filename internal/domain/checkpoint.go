@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+// CheckpointConfig — периодическое сохранение решений обработанных точек,
+// позволяющее продолжить прерванную обработку
+type CheckpointConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// File — имя файла контрольной точки в каталоге output.dir (с префиксом output.prefix)
+	File string `yaml:"file"`
+	// Interval — период сохранения контрольной точки
+	Interval time.Duration `yaml:"interval"`
+	// Resume — продолжить обработку с сохраненной контрольной точки (аргумент -resume)
+	Resume bool `yaml:"resume"`
+}
+
+// Checkpoint — сохраненное состояние обработки набора данных
+type Checkpoint struct {
+	// Hash — хеш входных матриц и влияющих на решение параметров конфигурации
+	Hash       string
+	Rows, Cols int
+	// Seed — seed генератора, с которым получены решения (в хеш не входит,
+	// чтобы обработку с seed от текущего времени можно было продолжить)
+	Seed int64
+	// Results — решения обработанных точек, включая точки без решения
+	Results []ProcessingResult
+}
@@ -0,0 +1,58 @@
+package domain
+
+// Component описывает компоненту аэрозольной смеси (тип аэрозоля)
+type Component struct {
+	// Name — короткое имя, используемое в именах продуктов (n_<name>, GF_<name>, ...)
+	Name string `yaml:"name"`
+	// LongName — описание для метаданных выходных файлов
+	LongName string  `yaml:"long_name"`
+	LR       float64 `yaml:"LR"`
+	CV       float64 `yaml:"CV"`
+	// Априорные распределения параметров: [min, max] или распределение (см. Prior)
+	GfRange    Prior `yaml:"Gf_range"`
+	MRange     Prior `yaml:"m_range"`
+	DeltaRange Prior `yaml:"delta_range"`
+}
+
+// Title возвращает описание компоненты или её имя, если описание не задано
+func (c Component) Title() string {
+	if c.LongName != "" {
+		return c.LongName
+	}
+	return c.Name
+}
+
+// LegacyComponents строит список компонент из устаревшего формата конфигурации
+// с фиксированными типами d (пыль), u (городской), s (дым) и w (вода)
+func (c *Config) LegacyComponents() []Component {
+	return []Component{
+		{
+			Name: "d", LongName: "dust", LR: c.LR.D, CV: c.CV.D,
+			GfRange: c.GfRange.D, MRange: c.MRange.D, DeltaRange: c.DeltaRange.D,
+		},
+		{
+			Name: "u", LongName: "urban", LR: c.LR.U, CV: c.CV.U,
+			GfRange: c.GfRange.U, MRange: c.MRange.U, DeltaRange: c.DeltaRange.U,
+		},
+		{
+			Name: "s", LongName: "smoke", LR: c.LR.S, CV: c.CV.S,
+			GfRange: c.GfRange.S, MRange: c.MRange.S, DeltaRange: c.DeltaRange.S,
+		},
+		{
+			Name: "w", LongName: "water", LR: c.LR.W, CV: c.CV.W,
+			GfRange: c.GfRange.W, MRange: c.MRange.W, DeltaRange: c.DeltaRange.W,
+		},
+	}
+}
+
+// ComponentProducts возвращает имена продуктов, вычисляемых для каждой компоненты
+func (c *Config) ComponentProducts() []string {
+	prefixes := []string{"n_", "GF_", "delta_", "mre_"}
+	names := make([]string, 0, len(prefixes)*len(c.Components))
+	for _, prefix := range prefixes {
+		for _, comp := range c.Components {
+			names = append(names, prefix+comp.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,50 @@
+package domain
+
+// DumpConfig — запись всех выборок Монте-Карло в выбранных точках
+type DumpConfig struct {
+	// Points — индексы точек [i, j] (i — номер высоты, j — номер времени)
+	Points [][2]int `yaml:"points,omitempty"`
+	// Labels — точки по меткам высоты и времени
+	Labels []PointLabel `yaml:"labels,omitempty"`
+	// Format — формат файлов: json или csv
+	Format string `yaml:"format"`
+}
+
+// PointLabel задает точку меткой времени и высотой; выбирается ближайшая
+// метка высоты и совпадающая метка времени
+type PointLabel struct {
+	Altitude float64 `yaml:"altitude"`
+	Time     string  `yaml:"time"`
+}
+
+// DumpFormats — допустимые значения параметра dump.format
+var DumpFormats = []string{"json", "csv"}
+
+// Enabled сообщает, выбрана ли хотя бы одна точка
+func (d DumpConfig) Enabled() bool {
+	return len(d.Points) > 0 || len(d.Labels) > 0
+}
+
+// SampleRecord — одна выборка Монте-Карло в точке
+type SampleRecord struct {
+	// Attempt — номер выборки, начиная с 1
+	Attempt    int
+	Parameters Parameters
+	Fractions  Fractions
+	Residual   float64
+	// Iterations и Converged — число итераций и признак сходимости оптимизатора
+	Iterations int
+	Converged  bool
+	// Valid — невязка меньше epsilon
+	Valid bool
+	// Best — выборка вошла в N1 лучших решений, по которым усредняется результат
+	Best bool
+}
+
+// SampleDump — все выборки одной точки с ее измерениями и метками
+type SampleDump struct {
+	Data     PointData
+	Altitude float64
+	Time     string
+	Samples  []SampleRecord
+}
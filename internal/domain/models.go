@@ -2,41 +2,238 @@ package domain
 
 import (
 	"errors"
+	"time"
 )
 
 // Config представляет конфигурацию приложения
 type Config struct {
-	LR LRCoeffs `yaml:"LR"`
-	CV CVCoeffs `yaml:"CV"`
+	Components []Component `yaml:"components"`
+	// Устаревший формат описания четырех фиксированных типов (d, u, s, w);
+	// используется, только если список components не задан
+	LR LRCoeffs `yaml:"LR,omitempty"`
+	CV CVCoeffs `yaml:"CV,omitempty"`
 	//M            MCoeffs    `yaml:"m"`
-	MRange          TypeRanges `yaml:"m_range"`
-	DeltaRange      TypeRanges `yaml:"delta_range"`
-	GfRange         TypeRanges `yaml:"Gf_range"`
-	NSamples        int        `yaml:"NSamples"`
-	N1              int        `yaml:"N1"`
-	Epsilon         float64    `yaml:"epsilon"`
-	Workers         int        `yaml:"workers"`
-	LogLevel        string     `yaml:"log_level"`
-	Method          string     `yaml:"method"`
-	LogFile         string     `yaml:"log_file"`
-	CostFunction    string     `yaml:"cost_function"`
-	DecimalsDefault int        `yaml:"decimals_default"`
-	DecimalsGf      int        `yaml:"decimals_gf"`
+	MRange     TypeRanges `yaml:"m_range,omitempty"`
+	DeltaRange TypeRanges `yaml:"delta_range,omitempty"`
+	GfRange    TypeRanges `yaml:"Gf_range,omitempty"`
+	// Mode — способ решения для точки: montecarlo (оптимизация по выборкам
+	// параметров) или mcmc (выборка из апостериорного распределения)
+	Mode string     `yaml:"mode"`
+	MCMC MCMCConfig `yaml:"mcmc"`
+	// NSamples — число выборок на точку (в адаптивном режиме — наибольшее)
+	NSamples int            `yaml:"NSamples"`
+	Adaptive AdaptiveConfig `yaml:"adaptive"`
+	// Sampling — способ выбора параметров: random, halton, sobol или lhs
+	Sampling string `yaml:"sampling"`
+	N1       int    `yaml:"N1"`
+	// Averaging — способ усреднения N1 лучших решений: equal, inverse_residual,
+	// likelihood или median
+	Averaging string  `yaml:"averaging"`
+	Epsilon   float64 `yaml:"epsilon"`
+	Seed      int64   `yaml:"seed"`
+	Workers   int     `yaml:"workers"`
+	// Timeout — ограничение времени работы программы (0 — без ограничения).
+	// По его истечении записываются результаты обработанных точек
+	Timeout  time.Duration `yaml:"timeout"`
+	LogLevel string        `yaml:"log_level"`
+	Method   string        `yaml:"method"`
+	// Parameterization — пространство, в котором работает оптимизатор:
+	// direct, softmax или stickbreaking
+	Parameterization string `yaml:"parameterization"`
+	LogFile          string `yaml:"log_file"`
+	// GradientCheck включает сравнение аналитического градиента с конечно-разностным
+	GradientCheck   bool    `yaml:"gradient_check"`
+	CostFunction    string  `yaml:"cost_function"`
+	LossScale       float64 `yaml:"loss_scale"`
+	DecimalsDefault int     `yaml:"decimals_default"`
+	DecimalsGf      int     `yaml:"decimals_gf"`
+	Percentiles     bool    `yaml:"percentiles"`
+	// Progress — вывод хода обработки
+	Progress ProgressConfig `yaml:"progress"`
+	// Trace — подробная диагностика решения в выбранных точках
+	Trace TraceConfig `yaml:"trace"`
+	// Dump — запись всех выборок в выбранных точках
+	Dump DumpConfig `yaml:"dump"`
+	// Checkpoint — контрольные точки для продолжения прерванной обработки
+	Checkpoint CheckpointConfig `yaml:"checkpoint"`
+	// TypeMap — карта преобладающего типа аэрозоля (продукт aerosol_type)
+	TypeMap      TypeMapConfig `yaml:"type_map"`
+	OutputFormat string        `yaml:"output_format"`
+	Input        InputFiles    `yaml:"input"`
+	Output       OutputDest    `yaml:"output"`
+	NetCDF       NetCDFVars    `yaml:"netcdf"`
+}
+
+// ProgressConfig — параметры вывода хода обработки. В терминале строка хода
+// обновляется на месте, иначе раз в Interval пишется запись в журнал
+type ProgressConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// MCMCConfig — параметры ансамблевого сэмплера в режиме mcmc
+type MCMCConfig struct {
+	// Walkers — число блуждающих точек ансамбля (не меньше удвоенной размерности)
+	Walkers int `yaml:"walkers"`
+	// Steps — число шагов после прогрева, по которым оценивается апостериорное распределение
+	Steps int `yaml:"steps"`
+	// BurnIn — число отбрасываемых шагов прогрева
+	BurnIn int `yaml:"burn_in"`
+	// MaxSteps — наибольшее число шагов после прогрева: пока R-hat больше
+	// MaxRHat, число шагов удваивается
+	MaxSteps int `yaml:"max_steps"`
+	// MaxRHat — наибольшее значение R-hat, при котором цепи считаются сошедшимися
+	MaxRHat float64 `yaml:"max_rhat"`
+	// RelativeError — относительная погрешность измерений, если матрица погрешностей не задана
+	RelativeError float64 `yaml:"relative_error"`
+}
+
+// AdaptiveConfig — параметры адаптивного числа выборок в режиме montecarlo.
+// Выборки добавляются порциями, пока среднее и разброс долей по N1 лучшим
+// решениям не перестанут меняться или не будет исчерпан бюджет NSamples.
+type AdaptiveConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MinSamples — число выборок до первой проверки сходимости
+	MinSamples int `yaml:"min_samples"`
+	// BatchSize — число выборок между проверками сходимости
+	BatchSize int `yaml:"batch_size"`
+	// Tolerance — допустимое изменение среднего и стандартного отклонения долей между проверками
+	Tolerance float64 `yaml:"tolerance"`
+	// GiveUpAfter — число выборок, после которого точка без единого решения
+	// с невязкой меньше epsilon пропускается (0 — не пропускать)
+	GiveUpAfter int `yaml:"give_up_after"`
+}
+
+// Dim возвращает размерность пространства сэмплера для n компонент:
+// n-1 переменная долей и по три параметра на компоненту
+func (m MCMCConfig) Dim(n int) int {
+	return n - 1 + 3*n
+}
+
+// InputFiles содержит пути к входным матрицам. Файлы с расширением .nc
+// читаются как NetCDF, остальные - как текстовые таблицы.
+// Матрицы погрешностей (*Err) необязательны и задаются в тех же единицах, что и данные.
+type InputFiles struct {
+	Dep      string `yaml:"dep"`
+	FlCap    string `yaml:"fl_cap"`
+	Mre      string `yaml:"mre"`
+	DepErr   string `yaml:"dep_err"`
+	FlCapErr string `yaml:"fl_cap_err"`
+	MreErr   string `yaml:"mre_err"`
+}
+
+// OutputDest задает каталог и префикс имен выходных файлов
+type OutputDest struct {
+	Dir    string `yaml:"dir"`
+	Prefix string `yaml:"prefix"`
+}
+
+// NetCDFVars описывает имена переменных во входном NetCDF-файле.
+// File, если задан, используется для всех входных матриц, путь к которым не указан явно.
+type NetCDFVars struct {
+	File        string `yaml:"file"`
+	AltitudeVar string `yaml:"altitude_var"`
+	TimeVar     string `yaml:"time_var"`
+	DepVar      string `yaml:"dep_var"`
+	FlCapVar    string `yaml:"fl_cap_var"`
+	MreVar      string `yaml:"mre_var"`
+	DepErrVar   string `yaml:"dep_err_var"`
+	FlCapErrVar string `yaml:"fl_cap_err_var"`
+	MreErrVar   string `yaml:"mre_err_var"`
+}
+
+// solverModes сопоставляет значения параметра mode способам решения
+var solverModes = map[string]SolverMode{
+	"montecarlo": ModeMonteCarlo,
+	"mcmc":       ModeMCMC,
+}
+
+// averagings сопоставляет значения параметра averaging способам усреднения решений
+var averagings = map[string]Averaging{
+	"equal":            AverageEqual,
+	"inverse_residual": AverageInverseResidual,
+	"likelihood":       AverageLikelihood,
+	"median":           AverageMedian,
+}
+
+// optMethods сопоставляет значения параметра method методам оптимизации
+var optMethods = map[string]OptimizationMethod{
+	"nelder-mead": MethodNelderMead,
+	"gradient":    MethodGradientDescent,
+	"simann":      MethodSimulatedAnnealing,
+	"lbfgs":       MethodLBFGSB,
+	"lsq":         MethodLeastSquares,
+}
+
+// lossFunctions сопоставляет значения параметра cost_function функциям потерь
+var lossFunctions = map[string]LossFunction{
+	"l2":     LossL2,
+	"l1":     LossL1,
+	"huber":  LossHuber,
+	"cauchy": LossCauchy,
+	"chi2":   LossChiSquare,
+}
+
+// parameterizations сопоставляет значения параметра parameterization способам задания долей
+var parameterizations = map[string]Parameterization{
+	"direct":        ParamDirect,
+	"softmax":       ParamSoftmax,
+	"stickbreaking": ParamStickBreaking,
+}
+
+// samplings сопоставляет значения параметра sampling способам выбора параметров
+var samplings = map[string]Sampling{
+	"random": SamplingRandom,
+	"halton": SamplingHalton,
+	"sobol":  SamplingSobol,
+	"lhs":    SamplingLHS,
+}
+
+// GetMode возвращает способ решения для точки
+func (c *Config) GetMode() SolverMode {
+	if mode, ok := solverModes[c.Mode]; ok {
+		return mode
+	}
+	return ModeMonteCarlo
+}
+
+// GetAveraging возвращает способ усреднения лучших решений
+func (c *Config) GetAveraging() Averaging {
+	if averaging, ok := averagings[c.Averaging]; ok {
+		return averaging
+	}
+	return AverageEqual
 }
 
 func (c *Config) GetOptMethod() OptimizationMethod {
-	switch c.Method {
+	if method, ok := optMethods[c.Method]; ok {
+		return method
+	}
+	return MethodNelderMead
+}
+
+// GetSampling возвращает способ выбора микрофизических параметров
+func (c *Config) GetSampling() Sampling {
+	if sampling, ok := samplings[c.Sampling]; ok {
+		return sampling
+	}
+	return SamplingRandom
+}
 
-	case "nelder-mead":
-		return MethodNelderMead
-	case "gradient":
-		return MethodGradientDescent
-	case "simann":
-		return MethodSimulatedAnnealing
+// GetParameterization возвращает способ задания долей для оптимизатора
+func (c *Config) GetParameterization() Parameterization {
+	if param, ok := parameterizations[c.Parameterization]; ok {
+		return param
+	}
+	return ParamDirect
+}
 
-	default:
-		return MethodNelderMead
+// GetLossFunction возвращает функцию потерь, заданную параметром cost_function
+func (c *Config) GetLossFunction() LossFunction {
+	if loss, ok := lossFunctions[c.CostFunction]; ok {
+		return loss
 	}
+	return LossL2
 }
 
 type LRCoeffs struct {
@@ -61,10 +258,10 @@ type MCoeffs struct {
 }
 
 type TypeRanges struct {
-	D []float64 `yaml:"d"`
-	U []float64 `yaml:"u"`
-	S []float64 `yaml:"s"`
-	W []float64 `yaml:"w"`
+	D Prior `yaml:"d"`
+	U Prior `yaml:"u"`
+	S Prior `yaml:"s"`
+	W Prior `yaml:"w"`
 }
 
 // MatrixData представляет данные матрицы с метками
@@ -75,12 +272,24 @@ type MatrixData struct {
 	Rows, Cols   int
 }
 
-// PointData представляет данные для одной точки
+// PointData представляет данные для одной точки.
+// Погрешности (*Err) равны NaN, если для точки они не заданы.
 type PointData struct {
-	I, J       int
-	DeltaPrime float64
-	Gf         float64
-	M          float64
+	I, J          int
+	DeltaPrime    float64
+	Gf            float64
+	M             float64
+	DeltaPrimeErr float64
+	GfErr         float64
+	MErr          float64
+	// Dump — сохранить все выборки точки в Solution.SampleRecords
+	Dump bool
+}
+
+// MeasurementErrors содержит необязательные матрицы погрешностей измерений
+// (nil — погрешность не задана)
+type MeasurementErrors struct {
+	Dep, FlCap, Mre *MatrixData
 }
 
 // Solution представляет решение для точки
@@ -90,20 +299,74 @@ type Solution struct {
 	Parameters Parameters
 	IsValid    bool
 	Difference []float64
+
+	// Стандартное отклонение по ансамблю лучших выборок
+	FractionsStd  Fractions
+	ParametersStd Parameters
+	// Процентили по ансамблю (уровни PercentileLevels), если включены в конфигурации
+	Percentiles []Percentile
+
+	// Диагностика сходимости сэмплера (только в режиме mcmc)
+	Diagnostics *SamplerDiagnostics
+	// Samples — число выполненных выборок (в режиме montecarlo)
+	Samples int
+	// SampleRecords — все выборки, если для точки задан PointData.Dump
+	SampleRecords []SampleRecord
+}
+
+// SamplerDiagnostics — диагностика цепей MCMC для точки
+type SamplerDiagnostics struct {
+	// Acceptance — средняя доля принятых предложений
+	Acceptance float64
+	// RHat — наибольшая по переменным статистика Гельмана-Рубина (близка к 1 при сходимости)
+	RHat float64
+	// ESS — наименьший по переменным эффективный размер выборки
+	ESS float64
+	// Steps — число выполненных шагов после прогрева
+	Steps int
+	// Converged — R-hat не больше MCMCConfig.MaxRHat
+	Converged bool
+}
+
+// PercentileLevels — уровни процентилей, вычисляемых по ансамблю решений
+var PercentileLevels = []float64{16, 50, 84}
+
+// Percentile содержит значения долей и параметров на заданном уровне процентиля
+type Percentile struct {
+	Level      float64
+	Fractions  Fractions
+	Parameters Parameters
 }
 
-type Fractions struct {
-	D, U, S, W float64
+// Fractions — объемные доли компонент в порядке Config.Components
+type Fractions []float64
+
+// ComponentParameters — микрофизические параметры одной компоненты
+type ComponentParameters struct {
+	Gf         float64
+	DeltaPrime float64
+	Mre        float64
 }
 
-func (f Fractions) Array() []float64 {
-	return []float64{f.D, f.U, f.S, f.W}
+// Parameters — параметры компонент в порядке Config.Components
+type Parameters []ComponentParameters
+
+// Array возвращает параметры в виде плоского среза (Gf, DeltaPrime, Mre для каждой компоненты)
+func (p Parameters) Array() []float64 {
+	a := make([]float64, 0, 3*len(p))
+	for _, c := range p {
+		a = append(a, c.Gf, c.DeltaPrime, c.Mre)
+	}
+	return a
 }
 
-type Parameters struct {
-	GfD, GfU, GfS, GfW                                 float64
-	DeltaDPrime, DeltaUPrime, DeltaSPrime, DeltaWPrime float64
-	MreD, MreU, MreS, MreW                             float64
+// ParametersFromArray строит Parameters из среза в порядке Array
+func ParametersFromArray(a []float64) Parameters {
+	p := make(Parameters, len(a)/3)
+	for k := range p {
+		p[k] = ComponentParameters{Gf: a[3*k], DeltaPrime: a[3*k+1], Mre: a[3*k+2]}
+	}
+	return p
 }
 
 type ClassifyResults map[string]*MatrixData
@@ -114,6 +377,24 @@ type Histogram struct {
 	Len  int
 }
 
+// SolverMode представляет способ решения для точки
+type SolverMode int
+
+const (
+	ModeMonteCarlo SolverMode = iota // усреднение лучших решений по выборкам параметров
+	ModeMCMC                         // апостериорное распределение долей и параметров
+)
+
+// Averaging представляет способ усреднения N1 лучших решений по выборкам
+type Averaging int
+
+const (
+	AverageEqual           Averaging = iota // равные веса
+	AverageInverseResidual                  // веса 1/невязка
+	AverageLikelihood                       // веса exp(-невязка²/2)
+	AverageMedian                           // покомпонентная медиана
+)
+
 // OptimizationMethod представляет метод оптимизации
 type OptimizationMethod int
 
@@ -121,6 +402,42 @@ const (
 	MethodNelderMead OptimizationMethod = iota
 	MethodGradientDescent
 	MethodSimulatedAnnealing
+	MethodLBFGSB       // L-BFGS-B с границами [0, 1] для долей
+	MethodLeastSquares // линеаризованная задача НК с неотрицательными долями
+)
+
+// Sampling представляет способ выбора микрофизических параметров в единичном гиперкубе
+type Sampling int
+
+const (
+	SamplingRandom Sampling = iota // независимые равномерные случайные точки
+	SamplingHalton                 // последовательность Хальтона со случайным сдвигом
+	SamplingSobol                  // последовательность Соболя со случайным цифровым сдвигом
+	SamplingLHS                    // латинский гиперкуб
+)
+
+// MaxSobolDim — наибольшая размерность последовательности Соболя
+// (по три параметра на компоненту, то есть до 7 компонент)
+const MaxSobolDim = 21
+
+// Parameterization представляет способ задания долей компонент для оптимизатора
+type Parameterization int
+
+const (
+	ParamDirect        Parameterization = iota // доли — переменные оптимизации, ограничения через штрафы
+	ParamSoftmax                               // n_k = exp(z_k) / Σ exp(z_i)
+	ParamStickBreaking                         // последовательное разбиение единицы, n-1 переменная
+)
+
+// LossFunction представляет функцию потерь, применяемую к взвешенным невязкам уравнений
+type LossFunction int
+
+const (
+	LossL2        LossFunction = iota // sqrt(sum e^2)
+	LossL1                            // sum |e|
+	LossHuber                         // квадратичная при |e| <= scale, линейная дальше
+	LossCauchy                        // sum scale^2/2 * log(1 + (e/scale)^2)
+	LossChiSquare                     // sum e^2
 )
 
 var (
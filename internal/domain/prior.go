@@ -0,0 +1,193 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prior описывает априорное распределение микрофизического параметра.
+// В конфигурации задается либо списком [min, max] (равномерное распределение),
+// либо отображением с полем dist:
+//
+//	Gf_range: {dist: loguniform, min: 1e-9, max: 1e-5}
+//	delta_range: {dist: truncnormal, mean: 0.3, sigma: 0.05, min: 0.2, max: 0.4}
+//	m_range: {dist: lognormal, median: 1.5, gsd: 1.02}
+type Prior struct {
+	// Dist — uniform, normal, truncnormal, loguniform или lognormal
+	Dist string `yaml:"dist"`
+	// Min, Max — границы (uniform, loguniform, truncnormal)
+	Min float64 `yaml:"min,omitempty"`
+	Max float64 `yaml:"max,omitempty"`
+	// Mean, Sigma — среднее и стандартное отклонение (normal, truncnormal)
+	Mean  float64 `yaml:"mean,omitempty"`
+	Sigma float64 `yaml:"sigma,omitempty"`
+	// Median, GSD — медиана и геометрическое стандартное отклонение (lognormal)
+	Median float64 `yaml:"median,omitempty"`
+	GSD    float64 `yaml:"gsd,omitempty"`
+
+	// listLen — длина списка, если распределение задано как [min, max]
+	// (-1 — задано отображением); используется при проверке конфигурации
+	listLen int
+}
+
+// Распределения Prior.Dist
+const (
+	DistUniform     = "uniform"
+	DistNormal      = "normal"
+	DistTruncNormal = "truncnormal"
+	DistLogUniform  = "loguniform"
+	DistLogNormal   = "lognormal"
+)
+
+func (p *Prior) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		var values []float64
+		if err := node.Decode(&values); err != nil {
+			return err
+		}
+		*p = Prior{Dist: DistUniform, listLen: len(values)}
+		if len(values) == 2 {
+			p.Min, p.Max = values[0], values[1]
+		}
+		return nil
+	}
+
+	type plain Prior
+	var value plain
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	*p = Prior(value)
+	p.listLen = -1
+	if p.Dist == "" {
+		p.Dist = DistUniform
+	}
+	return nil
+}
+
+// MarshalYAML записывает распределение в той же форме, в какой оно задается
+// в конфигурации: [min, max] или {dist: ..., ...}
+func (p Prior) MarshalYAML() (any, error) {
+	type plain Prior
+	var value any = plain(p)
+	if p.Dist == DistUniform && p.listLen >= 0 {
+		value = []float64{p.Min, p.Max}
+	}
+
+	node := &yaml.Node{}
+	err := node.Encode(value)
+	node.Style = yaml.FlowStyle
+	return node, err
+}
+
+// quantileMargin — отступ уровня от 0 и 1 в Quantile, чтобы обратная функция
+// нормального распределения была конечной
+const quantileMargin = 1e-12
+
+// Quantile возвращает значение параметра для уровня u из [0, 1)
+// (обратная функция распределения). Точка единичного гиперкуба из Sampler
+// отображается в значение с заданным распределением.
+func (p Prior) Quantile(u float64) float64 {
+	u = math.Min(math.Max(u, quantileMargin), 1-quantileMargin)
+
+	switch p.Dist {
+	case DistNormal:
+		return p.Mean + p.Sigma*normalQuantile(u)
+	case DistTruncNormal:
+		lo := normalCDF((p.Min - p.Mean) / p.Sigma)
+		hi := normalCDF((p.Max - p.Mean) / p.Sigma)
+		x := p.Mean + p.Sigma*normalQuantile(lo+u*(hi-lo))
+		return math.Min(math.Max(x, p.Min), p.Max)
+	case DistLogUniform:
+		return math.Exp(math.Log(p.Min) + u*(math.Log(p.Max)-math.Log(p.Min)))
+	case DistLogNormal:
+		return p.Median * math.Pow(p.GSD, normalQuantile(u))
+	default:
+		return p.Min + u*(p.Max-p.Min)
+	}
+}
+
+// validate проверяет параметры распределения. lower — наименьшее физически
+// допустимое значение параметра. Возвращает описание ошибки или пустую строку.
+func (p Prior) validate(lower float64) string {
+	finite := func(values ...float64) bool {
+		for _, v := range values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch p.Dist {
+	case "":
+		return "is required"
+	case DistUniform:
+		if p.listLen >= 0 && p.listLen != 2 {
+			return fmt.Sprintf("must contain exactly two values [min, max], got %d", p.listLen)
+		}
+		return checkBounds(p.Min, p.Max, lower)
+	case DistLogUniform:
+		if msg := checkBounds(p.Min, p.Max, lower); msg != "" {
+			return msg
+		}
+		if !(p.Min > 0) {
+			return fmt.Sprintf("loguniform requires positive min, got %v", p.Min)
+		}
+	case DistNormal, DistTruncNormal:
+		if !finite(p.Mean) || !(p.Sigma > 0) || !finite(p.Sigma) {
+			return fmt.Sprintf("%s requires finite mean and positive sigma, got mean %v, sigma %v", p.Dist, p.Mean, p.Sigma)
+		}
+		if p.Dist == DistNormal {
+			// Нормальное распределение не ограничено, поэтому все значения,
+			// которые может вернуть Quantile, должны быть не меньше lower
+			if least := p.Mean + p.Sigma*normalQuantile(quantileMargin); least < lower {
+				return fmt.Sprintf("normal with mean %v and sigma %v gives values down to %.3g, below %v; use truncnormal with min >= %v",
+					p.Mean, p.Sigma, least, lower, lower)
+			}
+		}
+		if p.Dist == DistTruncNormal {
+			if msg := checkBounds(p.Min, p.Max, lower); msg != "" {
+				return msg
+			}
+			if p.Min == p.Max {
+				return fmt.Sprintf("truncnormal requires min < max, got [%v %v]", p.Min, p.Max)
+			}
+		}
+	case DistLogNormal:
+		if !(p.Median > 0) || !finite(p.Median) || !(p.GSD > 1) || !finite(p.GSD) {
+			return fmt.Sprintf("lognormal requires positive median and gsd > 1, got median %v, gsd %v", p.Median, p.GSD)
+		}
+	default:
+		return fmt.Sprintf("unknown distribution %q, expected one of uniform, normal, truncnormal, loguniform, lognormal", p.Dist)
+	}
+	return ""
+}
+
+// checkBounds проверяет, что границы конечны, упорядочены и не меньше lower
+func checkBounds(min, max, lower float64) string {
+	for _, v := range []float64{min, max} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprintf("values must be finite, got [%v %v]", min, max)
+		}
+	}
+	if min > max {
+		return fmt.Sprintf("min must not exceed max, got [%v %v]", min, max)
+	}
+	if min < lower {
+		return fmt.Sprintf("values must not be less than %v, got [%v %v]", lower, min, max)
+	}
+	return ""
+}
+
+// normalCDF — функция стандартного нормального распределения
+func normalCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+// normalQuantile — обратная функция стандартного нормального распределения
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPriorValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		prior Prior
+		// want — фрагмент сообщения об ошибке (пусто — распределение допустимо)
+		want string
+	}{
+		{name: "uniform", prior: Prior{Dist: DistUniform, Min: 1e-5, Max: 1e-4, listLen: 2}},
+		{name: "uniform below lower", prior: Prior{Dist: DistUniform, Min: -0.1, Max: 0.3, listLen: 2}, want: "must not be less than 0"},
+		{name: "loguniform zero min", prior: Prior{Dist: DistLogUniform, Min: 0, Max: 1e-5}, want: "positive min"},
+		{name: "normal far from lower", prior: Prior{Dist: DistNormal, Mean: 1.53, Sigma: 0.01}},
+		{name: "normal reaching below lower", prior: Prior{Dist: DistNormal, Mean: 5e-5, Sigma: 2e-5}, want: "use truncnormal"},
+		{name: "normal negative mean", prior: Prior{Dist: DistNormal, Mean: -0.1, Sigma: 0.01}, want: "use truncnormal"},
+		{name: "normal zero sigma", prior: Prior{Dist: DistNormal, Mean: 1.5}, want: "positive sigma"},
+		{name: "truncnormal near lower", prior: Prior{Dist: DistTruncNormal, Mean: 5e-5, Sigma: 2e-5, Min: 0, Max: 1e-4}},
+		{name: "truncnormal below lower", prior: Prior{Dist: DistTruncNormal, Mean: 0.1, Sigma: 0.1, Min: -1, Max: 1}, want: "must not be less than 0"},
+		{name: "lognormal", prior: Prior{Dist: DistLogNormal, Median: 5e-4, GSD: 1.5}},
+		{name: "unknown", prior: Prior{Dist: "gamma"}, want: "unknown distribution"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.prior.validate(0)
+			if tt.want == "" && got != "" {
+				t.Fatalf("validate = %q, want no error", got)
+			}
+			if !strings.Contains(got, tt.want) || (tt.want != "" && got == "") {
+				t.Fatalf("validate = %q, want error containing %q", got, tt.want)
+			}
+			if got != "" {
+				return
+			}
+			// Допустимое распределение не дает значений меньше lower ни на одном уровне
+			for _, u := range []float64{0, 1e-15, 1e-6, 0.5, 1 - 1e-15} {
+				if x := tt.prior.Quantile(u); x < 0 {
+					t.Errorf("Quantile(%g) = %g < 0", u, x)
+				}
+			}
+		})
+	}
+}
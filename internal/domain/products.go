@@ -0,0 +1,69 @@
+package domain
+
+import "strings"
+
+// ProductInfo возвращает описание (long_name) и единицы измерения продукта
+// классификации по его имени в ClassifyResults.
+func ProductInfo(name string, components []Component) (longName, units string) {
+	// Продукты разброса по ансамблю: <имя>_std, <имя>_p16 и т.д.
+	if base, ok := strings.CutSuffix(name, "_std"); ok {
+		longName, units = ProductInfo(base, components)
+		return "standard deviation of " + longName, units
+	}
+	if i := strings.LastIndex(name, "_p"); i > 0 {
+		if level := name[i+2:]; level != "" && strings.Trim(level, "0123456789.") == "" {
+			longName, units = ProductInfo(name[:i], components)
+			return level + "th percentile of " + longName, units
+		}
+	}
+
+	switch name {
+	case "residuals":
+		return "residual of the averaged best Monte Carlo solutions", "1"
+	case TypeMapProduct:
+		return "dominant aerosol type", "1"
+	case "completed":
+		return "processing completed flag", "1"
+	case "samples":
+		return "number of Monte Carlo samples", "1"
+	case "acceptance":
+		return "MCMC acceptance fraction", "1"
+	case "rhat":
+		return "maximum split Gelman-Rubin statistic of MCMC chains", "1"
+	case "ess":
+		return "minimum effective sample size of MCMC chains", "1"
+	case "converged":
+		return "MCMC convergence flag (Gelman-Rubin statistic within limit)", "1"
+	case "steps":
+		return "number of MCMC steps after burn-in", "1"
+	}
+
+	if eq, ok := strings.CutPrefix(name, "diff_eq"); ok {
+		return "relative deviation of mixture equation " + eq, "percent"
+	}
+
+	prefix, suffix, ok := strings.Cut(name, "_")
+	if !ok {
+		return name, "1"
+	}
+	typeName := suffix
+	for _, comp := range components {
+		if comp.Name == suffix {
+			typeName = comp.Title()
+			break
+		}
+	}
+
+	switch prefix {
+	case "n":
+		return "volume fraction of " + typeName + " aerosol", "1"
+	case "GF":
+		return "fluorescence capacity of " + typeName + " aerosol", "1"
+	case "delta":
+		return "particle linear depolarization ratio of " + typeName + " aerosol", "1"
+	case "mre":
+		return "real part of refractive index of " + typeName + " aerosol", "1"
+	default:
+		return name, "1"
+	}
+}
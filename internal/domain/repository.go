@@ -15,6 +15,20 @@ type ConfigReader interface {
 	ReadConfig(path string) (*Config, error)
 }
 
+// CheckpointStore интерфейс хранилища контрольной точки обработки. Load
+// возвращает ошибку, удовлетворяющую errors.Is(err, fs.ErrNotExist), если
+// контрольная точка не сохранялась.
+type CheckpointStore interface {
+	Load() (*Checkpoint, error)
+	Save(checkpoint *Checkpoint) error
+	Remove() error
+}
+
+// SampleDumpWriter интерфейс для записи выборок отдельной точки
+type SampleDumpWriter interface {
+	WriteSamples(dump *SampleDump) error
+}
+
 type Historgammer interface {
 	Hist(min, max float64, n int) ([]float64, []float64, error)
 }
@@ -6,6 +6,20 @@ type ClassificationService interface {
 	ValidatePoint(data *PointData) bool
 }
 
+// PointSolver находит решение (доли и параметры компонент) для одной точки
+type PointSolver interface {
+	Solve(data *PointData, config *Config) *Solution
+}
+
+// ProgressReporter отображает ход обработки точек
+type ProgressReporter interface {
+	// Start вызывается перед обработкой total точек
+	Start(total int)
+	// Add вызывается для каждой обработанной точки; valid — найдено ли решение
+	Add(valid bool)
+	Finish()
+}
+
 // WorkerPool интерфейс пула воркеров
 type WorkerPool interface {
 	Start()
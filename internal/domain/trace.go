@@ -0,0 +1,35 @@
+package domain
+
+// TraceConfig — подробная диагностика решения в выбранных точках. Для них в
+// журнал (логгер trace, уровень info) пишутся значения функции стоимости,
+// результаты оптимизатора и итог по точке; в остальных точках записи не
+// формируются.
+type TraceConfig struct {
+	// Points — индексы точек [i, j] (i — номер высоты, j — номер времени)
+	Points [][2]int `yaml:"points,omitempty"`
+	// Rate — доля случайно выбранных точек (от 0 до 1); выбор определяется seed
+	Rate float64 `yaml:"rate"`
+}
+
+// Selected сообщает, включена ли диагностика для точки (i, j). Точки,
+// выбранные по Rate, при одинаковом seed не меняются от запуска к запуску.
+func (t TraceConfig) Selected(seed int64, i, j int) bool {
+	for _, p := range t.Points {
+		if p[0] == i && p[1] == j {
+			return true
+		}
+	}
+	if t.Rate <= 0 {
+		return false
+	}
+	h := splitMix64(uint64(seed) ^ splitMix64(uint64(i)<<32|uint64(uint32(j))))
+	return float64(h>>11)/(1<<53) < t.Rate
+}
+
+// splitMix64 — перемешивающая функция генератора SplitMix64
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,50 @@
+package domain
+
+import "testing"
+
+func TestTraceConfigSelected(t *testing.T) {
+	const rows, cols = 100, 100
+	selected := func(trace TraceConfig, seed int64) map[[2]int]bool {
+		points := make(map[[2]int]bool)
+		for i := range rows {
+			for j := range cols {
+				if trace.Selected(seed, i, j) {
+					points[[2]int{i, j}] = true
+				}
+			}
+		}
+		return points
+	}
+
+	if got := selected(TraceConfig{}, 1); len(got) != 0 {
+		t.Errorf("empty config selects %d points", len(got))
+	}
+	points := selected(TraceConfig{Points: [][2]int{{3, 7}, {99, 0}}}, 1)
+	if len(points) != 2 || !points[[2]int{3, 7}] || !points[[2]int{99, 0}] {
+		t.Errorf("explicit points: selected %v, want (3, 7) and (99, 0)", points)
+	}
+
+	// Доля точек, выбранных по rate, близка к rate и зависит только от seed
+	trace := TraceConfig{Rate: 0.1}
+	first, again, other := selected(trace, 1), selected(trace, 1), selected(trace, 2)
+	if n := len(first); n < 900 || n > 1100 {
+		t.Errorf("rate 0.1 selects %d of %d points", n, rows*cols)
+	}
+	if len(again) != len(first) {
+		t.Errorf("same seed selects %d and %d points", len(first), len(again))
+	}
+	for point := range first {
+		if !again[point] {
+			t.Fatalf("point %v is not selected again with the same seed", point)
+		}
+	}
+	common := 0
+	for point := range first {
+		if other[point] {
+			common++
+		}
+	}
+	if common > len(first)/2 {
+		t.Errorf("different seeds share %d of %d points", common, len(first))
+	}
+}
@@ -0,0 +1,56 @@
+package domain
+
+import "strings"
+
+// TypeMapProduct — имя продукта карты преобладающего типа аэрозоля
+const TypeMapProduct = "aerosol_type"
+
+// TypeMapConfig — параметры карты преобладающего типа аэрозоля
+type TypeMapConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Dominance — доля, начиная с которой компонента считается преобладающей
+	Dominance float64 `yaml:"dominance"`
+	// Thresholds — пороги преобладания отдельных компонент (по имени), заменяющие Dominance
+	Thresholds map[string]float64 `yaml:"thresholds,omitempty"`
+	// MixedMargin — если преобладающая доля превышает следующую по величине
+	// меньше чем на MixedMargin, точка относится к смеси
+	MixedMargin float64 `yaml:"mixed_margin"`
+}
+
+// Threshold возвращает порог преобладания компоненты name
+func (t TypeMapConfig) Threshold(name string) float64 {
+	if threshold, ok := t.Thresholds[name]; ok {
+		return threshold
+	}
+	return t.Dominance
+}
+
+// TypeClass описывает класс карты преобладающего типа аэрозоля
+type TypeClass struct {
+	Code int
+	// Name — имя класса без пробелов (для flag_meanings в NetCDF)
+	Name        string
+	Description string
+}
+
+// TypeUnclassified — код точек без решения. Компонента k (в порядке
+// Config.Components) имеет код k+1, смесь — код Config.TypeMixedCode().
+const TypeUnclassified = 0
+
+// TypeMixedCode возвращает код класса смеси (len(Components)+1)
+func (c *Config) TypeMixedCode() int {
+	return len(c.Components) + 1
+}
+
+// TypeClasses возвращает легенду карты преобладающего типа аэрозоля
+func (c *Config) TypeClasses() []TypeClass {
+	classes := []TypeClass{{Code: TypeUnclassified, Name: "unclassified", Description: "no solution"}}
+	for k, comp := range c.Components {
+		classes = append(classes, TypeClass{
+			Code:        k + 1,
+			Name:        strings.Join(strings.Fields(comp.Title()), "_") + "_dominated",
+			Description: comp.Title() + " dominated",
+		})
+	}
+	return append(classes, TypeClass{Code: c.TypeMixedCode(), Name: "mixed", Description: "no dominant type"})
+}
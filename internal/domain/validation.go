@@ -0,0 +1,204 @@
+package domain
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// FieldError описывает ошибку в значении параметра конфигурации.
+// Path — путь к параметру в YAML-файле, например "components[1].m_range".
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// OutputFormats — допустимые значения параметра output_format
+var OutputFormats = []string{"txt", "netcdf", "both"}
+
+// componentName — допустимые имена компонент (используются в именах файлов и переменных NetCDF)
+var componentName = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// Validate проверяет конфигурацию (после установки значений по умолчанию)
+// и возвращает все найденные ошибки.
+func (c *Config) Validate() []FieldError {
+	var errs []FieldError
+	add := func(path, format string, args ...any) {
+		errs = append(errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(c.Components) == 0 {
+		add("components", "at least one component is required")
+	}
+	names := make(map[string]bool, len(c.Components))
+	for k, comp := range c.Components {
+		path := fmt.Sprintf("components[%d]", k)
+		switch {
+		case !componentName.MatchString(comp.Name):
+			add(path+".name", "must be a non-empty alphanumeric string, got %q", comp.Name)
+		case names[comp.Name]:
+			add(path+".name", "duplicate component name %q", comp.Name)
+		}
+		names[comp.Name] = true
+
+		if !(comp.LR > 0) || math.IsInf(comp.LR, 0) {
+			add(path+".LR", "must be positive, got %v", comp.LR)
+		}
+		if !(comp.CV > 0) || math.IsInf(comp.CV, 0) {
+			add(path+".CV", "must be positive, got %v", comp.CV)
+		}
+		if msg := comp.GfRange.validate(0); msg != "" {
+			add(path+".Gf_range", "%s", msg)
+		}
+		if msg := comp.MRange.validate(0); msg != "" {
+			add(path+".m_range", "%s", msg)
+		}
+		if msg := comp.DeltaRange.validate(0); msg != "" {
+			add(path+".delta_range", "%s", msg)
+		}
+	}
+
+	if _, ok := solverModes[c.Mode]; !ok {
+		add("mode", "unknown mode %q, expected one of %s", c.Mode, knownNames(solverModes))
+	}
+	if c.GetMode() == ModeMCMC {
+		if dim := c.MCMC.Dim(len(c.Components)); c.MCMC.Walkers < 2*dim {
+			add("mcmc.walkers", "must be at least twice the number of sampled variables (%d), got %d", 2*dim, c.MCMC.Walkers)
+		}
+		if c.MCMC.Steps < 1 {
+			add("mcmc.steps", "must be positive, got %d", c.MCMC.Steps)
+		}
+		if c.MCMC.BurnIn < 0 {
+			add("mcmc.burn_in", "must not be negative, got %d", c.MCMC.BurnIn)
+		}
+		if c.MCMC.MaxSteps < c.MCMC.Steps {
+			add("mcmc.max_steps", "must not be less than mcmc.steps (%d), got %d", c.MCMC.Steps, c.MCMC.MaxSteps)
+		}
+		if !(c.MCMC.MaxRHat > 1) || math.IsInf(c.MCMC.MaxRHat, 0) {
+			add("mcmc.max_rhat", "must be greater than 1, got %v", c.MCMC.MaxRHat)
+		}
+		if !(c.MCMC.RelativeError > 0) || math.IsInf(c.MCMC.RelativeError, 0) {
+			add("mcmc.relative_error", "must be positive, got %v", c.MCMC.RelativeError)
+		}
+	}
+
+	if c.NSamples < 1 {
+		add("NSamples", "must be positive, got %d", c.NSamples)
+	}
+	if c.Adaptive.Enabled && c.GetMode() == ModeMonteCarlo {
+		if c.Adaptive.MinSamples < 1 {
+			add("adaptive.min_samples", "must be positive, got %d", c.Adaptive.MinSamples)
+		} else if c.Adaptive.MinSamples > c.NSamples {
+			add("adaptive.min_samples", "must not exceed NSamples (%d), got %d", c.NSamples, c.Adaptive.MinSamples)
+		}
+		if c.Adaptive.BatchSize < 1 {
+			add("adaptive.batch_size", "must be positive, got %d", c.Adaptive.BatchSize)
+		}
+		if !(c.Adaptive.Tolerance > 0) {
+			add("adaptive.tolerance", "must be positive, got %v", c.Adaptive.Tolerance)
+		}
+		if c.Adaptive.GiveUpAfter < 0 {
+			add("adaptive.give_up_after", "must not be negative, got %d", c.Adaptive.GiveUpAfter)
+		}
+	}
+	if c.N1 < 1 {
+		add("N1", "must be positive, got %d", c.N1)
+	} else if c.N1 > c.NSamples {
+		add("N1", "must not exceed NSamples (%d), got %d", c.NSamples, c.N1)
+	}
+	if _, ok := averagings[c.Averaging]; !ok {
+		add("averaging", "unknown averaging %q, expected one of %s", c.Averaging, knownNames(averagings))
+	}
+	if !(c.Epsilon > 0) {
+		add("epsilon", "must be positive, got %v", c.Epsilon)
+	}
+	if c.Workers < 1 {
+		add("workers", "must be positive, got %d", c.Workers)
+	}
+	if c.Timeout < 0 {
+		add("timeout", "must not be negative, got %s", c.Timeout)
+	}
+	if c.Trace.Rate < 0 || c.Trace.Rate > 1 {
+		add("trace.rate", "must be in [0, 1], got %g", c.Trace.Rate)
+	}
+	for k, p := range c.Trace.Points {
+		if p[0] < 0 || p[1] < 0 {
+			add(fmt.Sprintf("trace.points[%d]", k), "indices must not be negative, got [%d, %d]", p[0], p[1])
+		}
+	}
+	for k, p := range c.Dump.Points {
+		if p[0] < 0 || p[1] < 0 {
+			add(fmt.Sprintf("dump.points[%d]", k), "indices must not be negative, got [%d, %d]", p[0], p[1])
+		}
+	}
+	if !slices.Contains(DumpFormats, c.Dump.Format) {
+		add("dump.format", "unknown format %q, expected one of %s", c.Dump.Format, strings.Join(DumpFormats, ", "))
+	}
+	if c.Progress.Enabled && c.Progress.Interval <= 0 {
+		add("progress.interval", "must be positive, got %s", c.Progress.Interval)
+	}
+	if c.Checkpoint.Enabled && c.Checkpoint.Interval <= 0 {
+		add("checkpoint.interval", "must be positive, got %s", c.Checkpoint.Interval)
+	}
+	if _, ok := samplings[c.Sampling]; !ok {
+		add("sampling", "unknown sampling %q, expected one of %s", c.Sampling, knownNames(samplings))
+	} else if c.GetSampling() == SamplingSobol && 3*len(c.Components) > MaxSobolDim {
+		add("sampling", "sobol supports at most %d components, got %d", MaxSobolDim/3, len(c.Components))
+	}
+	if _, ok := optMethods[c.Method]; !ok {
+		add("method", "unknown method %q, expected one of %s", c.Method, knownNames(optMethods))
+	}
+	if _, ok := parameterizations[c.Parameterization]; !ok {
+		add("parameterization", "unknown parameterization %q, expected one of %s", c.Parameterization, knownNames(parameterizations))
+	}
+	if _, ok := lossFunctions[c.CostFunction]; !ok {
+		add("cost_function", "unknown loss function %q, expected one of %s", c.CostFunction, knownNames(lossFunctions))
+	}
+	if !(c.LossScale > 0) || math.IsInf(c.LossScale, 0) {
+		add("loss_scale", "must be positive, got %v", c.LossScale)
+	}
+	if c.DecimalsDefault < 0 {
+		add("decimals_default", "must not be negative, got %d", c.DecimalsDefault)
+	}
+	if c.DecimalsGf < 0 {
+		add("decimals_gf", "must not be negative, got %d", c.DecimalsGf)
+	}
+	if c.TypeMap.Enabled {
+		if !(c.TypeMap.Dominance > 0 && c.TypeMap.Dominance <= 1) {
+			add("type_map.dominance", "must be in (0, 1], got %v", c.TypeMap.Dominance)
+		}
+		for _, name := range slices.Sorted(maps.Keys(c.TypeMap.Thresholds)) {
+			threshold := c.TypeMap.Thresholds[name]
+			if !names[name] {
+				add("type_map.thresholds."+name, "unknown component %q", name)
+			} else if !(threshold > 0 && threshold <= 1) {
+				add("type_map.thresholds."+name, "must be in (0, 1], got %v", threshold)
+			}
+		}
+		if !(c.TypeMap.MixedMargin >= 0 && c.TypeMap.MixedMargin < 1) {
+			add("type_map.mixed_margin", "must be in [0, 1), got %v", c.TypeMap.MixedMargin)
+		}
+	}
+	if !slices.Contains(OutputFormats, c.OutputFormat) {
+		add("output_format", "unknown format %q, expected one of %s", c.OutputFormat, strings.Join(OutputFormats, ", "))
+	}
+
+	return errs
+}
+
+// knownNames возвращает отсортированный список допустимых значений параметра
+func knownNames[T any](m map[string]T) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,72 @@
+package infrastructure
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"lidar-classification/internal/domain"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// GobCheckpointStore хранит контрольную точку обработки в файле в формате gob
+type GobCheckpointStore struct {
+	logger   *zap.Logger
+	filename string
+}
+
+func NewGobCheckpointStore(logger *zap.Logger, filename string) *GobCheckpointStore {
+	return &GobCheckpointStore{logger: logger, filename: filename}
+}
+
+func (s *GobCheckpointStore) Load() (*domain.Checkpoint, error) {
+	file, err := os.Open(s.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var checkpoint domain.Checkpoint
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// Save записывает контрольную точку во временный файл и переименовывает его,
+// чтобы прерывание во время записи не повредило предыдущую контрольную точку
+func (s *GobCheckpointStore) Save(checkpoint *domain.Checkpoint) error {
+	tmpName := s.filename + ".tmp"
+	file, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	err = gob.NewEncoder(writer).Encode(checkpoint)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	s.logger.Debug("Checkpoint saved",
+		zap.String("file", s.filename),
+		zap.Int("points", len(checkpoint.Results)))
+	return os.Rename(tmpName, s.filename)
+}
+
+// Remove удаляет файл контрольной точки; отсутствие файла не считается ошибкой
+func (s *GobCheckpointStore) Remove() error {
+	if err := os.Remove(s.filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -1,10 +1,15 @@
 package infrastructure
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"lidar-classification/internal/domain"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
@@ -12,10 +17,45 @@ import (
 
 type YAMLConfigReader struct {
 	logger *zap.Logger
+	flags  *flag.FlagSet
 }
 
-func NewYAMLConfigReader(logger *zap.Logger) *YAMLConfigReader {
-	return &YAMLConfigReader{logger: logger}
+// NewYAMLConfigReader создает читатель конфигурации. Явно заданные аргументы
+// из flags (см. RegisterFlags) переопределяют значения из файла; flags может быть nil.
+func NewYAMLConfigReader(logger *zap.Logger, flags *flag.FlagSet) *YAMLConfigReader {
+	return &YAMLConfigReader{logger: logger, flags: flags}
+}
+
+// RegisterFlags регистрирует аргументы командной строки, переопределяющие параметры конфигурации
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.Int("workers", 0, "Number of workers")
+	fs.Duration("timeout", 0, "Processing time limit, e.g. 30m (0 - no limit)")
+	fs.String("mode", "", "Solver mode: montecarlo or mcmc")
+	fs.Int("nsamples", 0, "Number of samples")
+	fs.Bool("adaptive", false, "Stop sampling a point when the ensemble of best solutions stabilizes")
+	fs.String("sampling", "", "Parameter sampling: random, halton, sobol or lhs")
+	fs.Int("n1", 0, "Number of best solutions")
+	fs.String("averaging", "", "Averaging of best solutions: equal, inverse_residual, likelihood or median")
+	fs.Float64("epsilon", 0, "Residual threshold")
+	fs.Int64("seed", 0, "Random seed (0 - derive from current time)")
+	fs.String("log-level", "", "Log level")
+	fs.String("method", "", "Optimization method: lbfgs, lsq, nelder-mead, gradient or simann")
+	fs.String("parameterization", "", "Fractions parameterization: direct, softmax or stickbreaking")
+	fs.Bool("gradient-check", false, "Compare analytic gradient with finite differences")
+	fs.String("cost-function", "", "Loss function: l2, l1, huber, cauchy or chi2")
+	fs.String("dep", "", "Path to depolarization matrix")
+	fs.String("fl-cap", "", "Path to fluorescence capacity matrix")
+	fs.String("mre", "", "Path to refractive index matrix")
+	fs.String("dep-err", "", "Path to depolarization uncertainty matrix")
+	fs.String("fl-cap-err", "", "Path to fluorescence capacity uncertainty matrix")
+	fs.String("mre-err", "", "Path to refractive index uncertainty matrix")
+	fs.String("out-dir", "", "Output directory (created if missing)")
+	fs.String("out-prefix", "", "Prefix for output file names")
+	fs.String("output-format", "", "Output format: txt, netcdf or both")
+	fs.Bool("type-map", false, "Write the dominant aerosol type map")
+	fs.Float64("trace-rate", 0, "Fraction of randomly selected points with detailed solver tracing")
+	fs.Bool("progress", false, "Show processing progress")
+	fs.Bool("resume", false, "Resume processing from the checkpoint in the output directory")
 }
 
 func (r *YAMLConfigReader) ReadConfig(path string) (*domain.Config, error) {
@@ -24,55 +64,357 @@ func (r *YAMLConfigReader) ReadConfig(path string) (*domain.Config, error) {
 		return nil, err
 	}
 
-	var config domain.Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
 		return nil, err
 	}
 
+	var config domain.Config
+	if len(root.Content) > 0 {
+		if err := root.Decode(&config); err != nil {
+			return nil, err
+		}
+	}
+	legacy := findNode(&root, "components") == nil
+
 	// Применяем аргументы командной строки
-	r.applyCommandLineFlags(&config)
+	flagPaths := r.applyCommandLineFlags(&config)
+
+	// Значения по умолчанию устанавливаются только для параметров, не заданных
+	// ни в файле, ни аргументами, поэтому явно заданные некорректные значения
+	// (например, NSamples: 0) не заменяются, а сообщаются при проверке.
+	// Пустое значение (null) считается незаданным.
+	explicit := func(path string) bool {
+		node := findNode(&root, path)
+		return flagPaths[path] || (node != nil && node.Tag != "!!null")
+	}
+	r.setDefaults(&config, explicit)
 
-	// Устанавливаем значения по умолчанию
-	r.setDefaults(&config)
+	// Проверяем конфигурацию и сообщаем обо всех ошибках сразу
+	if problems := config.Validate(); len(problems) > 0 {
+		errs := make([]error, len(problems))
+		for k, problem := range problems {
+			yamlPath := problem.Path
+			if legacy {
+				yamlPath = legacyPath(yamlPath)
+			}
+			if node := findNode(&root, yamlPath); node != nil {
+				errs[k] = fmt.Errorf("%s:%d: %s: %s", path, node.Line, yamlPath, problem.Message)
+			} else {
+				errs[k] = fmt.Errorf("%s: %s: %s", path, yamlPath, problem.Message)
+			}
+		}
+		return nil, fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
 
 	return &config, nil
 }
 
-func (r *YAMLConfigReader) applyCommandLineFlags(config *domain.Config) {
-	workers := flag.Int("workers", config.Workers, "Number of workers")
-	nsamples := flag.Int("nsamples", config.NSamples, "Number of samples")
-	n1 := flag.Int("n1", config.N1, "Number of best solutions")
-	epsilon := flag.Float64("epsilon", config.Epsilon, "Residual threshold")
-	logLevel := flag.String("log-level", config.LogLevel, "Log level")
-	method := flag.String("method", config.Method, "Optimization method")
-
-	flag.Parse()
-
-	config.Workers = *workers
-	config.NSamples = *nsamples
-	config.N1 = *n1
-	config.Epsilon = *epsilon
-	config.LogLevel = *logLevel
-	config.Method = *method
+// findNode возвращает узел YAML-документа по пути вида "components[1].m_range"
+// или nil, если такого узла нет (например, значение задано по умолчанию).
+func findNode(root *yaml.Node, path string) *yaml.Node {
+	node := root
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		node = node.Content[0]
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		key, index, hasIndex := strings.Cut(part, "[")
+		node = mappingValue(node, key)
+		if node == nil {
+			return nil
+		}
+		if hasIndex {
+			k, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+			if err != nil || node.Kind != yaml.SequenceNode || k < 0 || k >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[k]
+		}
+	}
+	return node
+}
+
+// mappingValue возвращает значение ключа key в узле-отображении
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
 }
 
-func (r *YAMLConfigReader) setDefaults(config *domain.Config) {
-	if config.NSamples == 0 {
+// legacyPath переводит путь параметра компоненты ("components[1].m_range")
+// в путь устаревшего формата конфигурации ("m_range.u")
+func legacyPath(path string) string {
+	rest, ok := strings.CutPrefix(path, "components[")
+	if !ok {
+		return path
+	}
+	index, field, ok := strings.Cut(rest, "].")
+	k, err := strconv.Atoi(index)
+	names := []string{"d", "u", "s", "w"}
+	if !ok || err != nil || k < 0 || k >= len(names) {
+		return path
+	}
+	return field + "." + names[k]
+}
+
+// flagPaths — пути параметров конфигурации, переопределяемых аргументами
+var flagPaths = map[string]string{
+	"workers":          "workers",
+	"timeout":          "timeout",
+	"mode":             "mode",
+	"nsamples":         "NSamples",
+	"adaptive":         "adaptive.enabled",
+	"sampling":         "sampling",
+	"n1":               "N1",
+	"averaging":        "averaging",
+	"epsilon":          "epsilon",
+	"seed":             "seed",
+	"log-level":        "log_level",
+	"method":           "method",
+	"parameterization": "parameterization",
+	"gradient-check":   "gradient_check",
+	"cost-function":    "cost_function",
+	"dep":              "input.dep",
+	"fl-cap":           "input.fl_cap",
+	"mre":              "input.mre",
+	"dep-err":          "input.dep_err",
+	"fl-cap-err":       "input.fl_cap_err",
+	"mre-err":          "input.mre_err",
+	"out-dir":          "output.dir",
+	"out-prefix":       "output.prefix",
+	"output-format":    "output_format",
+	"type-map":         "type_map.enabled",
+	"trace-rate":       "trace.rate",
+	"progress":         "progress.enabled",
+	"resume":           "checkpoint.resume",
+}
+
+// applyCommandLineFlags применяет явно указанные аргументы и возвращает
+// множество путей переопределенных ими параметров (см. flagPaths)
+func (r *YAMLConfigReader) applyCommandLineFlags(config *domain.Config) map[string]bool {
+	applied := make(map[string]bool)
+	if r.flags == nil {
+		return applied
+	}
+
+	// Применяем только явно указанные аргументы
+	r.flags.Visit(func(f *flag.Flag) {
+		getter, ok := f.Value.(flag.Getter)
+		if !ok {
+			return
+		}
+		value := getter.Get()
+
+		switch f.Name {
+		case "workers":
+			config.Workers = value.(int)
+		case "timeout":
+			config.Timeout = value.(time.Duration)
+		case "mode":
+			config.Mode = value.(string)
+		case "nsamples":
+			config.NSamples = value.(int)
+		case "adaptive":
+			config.Adaptive.Enabled = value.(bool)
+		case "sampling":
+			config.Sampling = value.(string)
+		case "n1":
+			config.N1 = value.(int)
+		case "averaging":
+			config.Averaging = value.(string)
+		case "epsilon":
+			config.Epsilon = value.(float64)
+		case "seed":
+			config.Seed = value.(int64)
+		case "log-level":
+			config.LogLevel = value.(string)
+		case "method":
+			config.Method = value.(string)
+		case "parameterization":
+			config.Parameterization = value.(string)
+		case "gradient-check":
+			config.GradientCheck = value.(bool)
+		case "cost-function":
+			config.CostFunction = value.(string)
+		case "dep":
+			config.Input.Dep = value.(string)
+		case "fl-cap":
+			config.Input.FlCap = value.(string)
+		case "mre":
+			config.Input.Mre = value.(string)
+		case "dep-err":
+			config.Input.DepErr = value.(string)
+		case "fl-cap-err":
+			config.Input.FlCapErr = value.(string)
+		case "mre-err":
+			config.Input.MreErr = value.(string)
+		case "out-dir":
+			config.Output.Dir = value.(string)
+		case "out-prefix":
+			config.Output.Prefix = value.(string)
+		case "output-format":
+			config.OutputFormat = value.(string)
+		case "type-map":
+			config.TypeMap.Enabled = value.(bool)
+		case "trace-rate":
+			config.Trace.Rate = value.(float64)
+		case "progress":
+			config.Progress.Enabled = value.(bool)
+		case "resume":
+			config.Checkpoint.Resume = value.(bool)
+		}
+		applied[flagPaths[f.Name]] = true
+	})
+	return applied
+}
+
+// setDefaults устанавливает значения по умолчанию параметров, для которых
+// explicit возвращает false. Пустые пути файлов и имена переменных NetCDF
+// заменяются всегда. Seed = 0 не заменяется: его выбирает AerosolClassifier
+// при обработке (см. ProcessMatrices).
+func (r *YAMLConfigReader) setDefaults(config *domain.Config, explicit func(path string) bool) {
+	// Устаревший формат с фиксированными типами d, u, s, w
+	if len(config.Components) == 0 {
+		config.Components = config.LegacyComponents()
+		config.LR, config.CV = domain.LRCoeffs{}, domain.CVCoeffs{}
+		config.MRange, config.DeltaRange, config.GfRange = domain.TypeRanges{}, domain.TypeRanges{}, domain.TypeRanges{}
+	}
+	if !explicit("mode") {
+		config.Mode = "montecarlo"
+	}
+	if !explicit("mcmc.walkers") {
+		config.MCMC.Walkers = max(32, 2*config.MCMC.Dim(len(config.Components))+2)
+	}
+	if !explicit("mcmc.steps") {
+		config.MCMC.Steps = 2000
+	}
+	if !explicit("mcmc.burn_in") {
+		config.MCMC.BurnIn = 2000
+	}
+	if !explicit("mcmc.max_steps") {
+		config.MCMC.MaxSteps = 8 * config.MCMC.Steps
+	}
+	if !explicit("mcmc.max_rhat") {
+		config.MCMC.MaxRHat = 1.1
+	}
+	if !explicit("mcmc.relative_error") {
+		config.MCMC.RelativeError = 0.1
+	}
+	if !explicit("NSamples") {
 		config.NSamples = 100
 	}
-	if config.N1 == 0 {
+	if !explicit("adaptive.min_samples") {
+		config.Adaptive.MinSamples = min(20, config.NSamples)
+	}
+	if !explicit("adaptive.batch_size") {
+		config.Adaptive.BatchSize = 10
+	}
+	if !explicit("adaptive.tolerance") {
+		config.Adaptive.Tolerance = 0.01
+	}
+	if !explicit("sampling") {
+		config.Sampling = "random"
+	}
+	if !explicit("N1") {
 		config.N1 = 10
 	}
-	if config.Epsilon == 0 {
+	if !explicit("averaging") {
+		config.Averaging = "equal"
+	}
+	if !explicit("epsilon") {
 		config.Epsilon = 0.1
 	}
-	if config.Workers == 0 {
+	if !explicit("dump.format") {
+		config.Dump.Format = "json"
+	}
+	if !explicit("progress.interval") {
+		config.Progress.Interval = 10 * time.Second
+	}
+	// Продолжение обработки невозможно без сохранения контрольных точек
+	if config.Checkpoint.Resume {
+		config.Checkpoint.Enabled = true
+	}
+	if config.Checkpoint.File == "" {
+		config.Checkpoint.File = "checkpoint.gob"
+	}
+	if !explicit("checkpoint.interval") {
+		config.Checkpoint.Interval = time.Minute
+	}
+	if !explicit("workers") {
 		config.Workers = max(1, runtime.NumCPU()-1)
 	}
-	if config.LogLevel == "" {
+	if !explicit("log_level") {
 		config.LogLevel = "info"
 	}
-	if config.Method == "" {
+	if !explicit("method") {
 		config.Method = "lbfgs"
 	}
+	if !explicit("parameterization") {
+		config.Parameterization = "direct"
+	}
+	if !explicit("cost_function") {
+		config.CostFunction = "l2"
+	}
+	if !explicit("loss_scale") {
+		config.LossScale = 1
+	}
+	if !explicit("type_map.dominance") {
+		config.TypeMap.Dominance = 0.5
+	}
+	if !explicit("output_format") {
+		config.OutputFormat = "txt"
+	}
+	if config.Input.Dep == "" {
+		config.Input.Dep = defaultInput(config.NetCDF.File, "dep.txt")
+	}
+	if config.Input.FlCap == "" {
+		config.Input.FlCap = defaultInput(config.NetCDF.File, "FL_cap.txt")
+	}
+	if config.Input.Mre == "" {
+		config.Input.Mre = defaultInput(config.NetCDF.File, "mre.txt")
+	}
+	if config.Output.Dir == "" {
+		config.Output.Dir = "."
+	}
+	if config.NetCDF.AltitudeVar == "" {
+		config.NetCDF.AltitudeVar = "altitude"
+	}
+	if config.NetCDF.TimeVar == "" {
+		config.NetCDF.TimeVar = "time"
+	}
+	if config.NetCDF.DepVar == "" {
+		config.NetCDF.DepVar = "depolarization"
+	}
+	if config.NetCDF.FlCapVar == "" {
+		config.NetCDF.FlCapVar = "fluorescence_capacity"
+	}
+	if config.NetCDF.MreVar == "" {
+		config.NetCDF.MreVar = "refractive_index"
+	}
+	if config.NetCDF.DepErrVar == "" {
+		config.NetCDF.DepErrVar = "depolarization_error"
+	}
+	if config.NetCDF.FlCapErrVar == "" {
+		config.NetCDF.FlCapErrVar = "fluorescence_capacity_error"
+	}
+	if config.NetCDF.MreErrVar == "" {
+		config.NetCDF.MreErrVar = "refractive_index_error"
+	}
+}
+
+func defaultInput(netcdfFile, txtFile string) string {
+	if netcdfFile != "" {
+		return netcdfFile
+	}
+	return txtFile
 }
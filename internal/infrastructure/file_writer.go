@@ -6,8 +6,10 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 
 	"lidar-classification/internal/domain"
 )
@@ -49,6 +51,25 @@ func (w *TXTFileWriter) WriteMatrix(filename string, data *domain.MatrixData, fo
 	return nil
 }
 
+// WriteLegend записывает легенду карты типов аэрозоля: код, имя и описание класса
+func (w *TXTFileWriter) WriteLegend(filename string, classes []domain.TypeClass) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintf(writer, "Code\tName\tDescription\n")
+	for _, class := range classes {
+		fmt.Fprintf(writer, "%d\t%s\t%s\n", class.Code, class.Name, class.Description)
+	}
+
+	return nil
+}
+
 func (w *TXTFileWriter) WriteHistogram(filename string, hist *domain.Histogram) error {
 	file, err := os.Create(filename)
 	if err != nil {
@@ -70,3 +91,33 @@ func (w *TXTFileWriter) WriteHistogram(filename string, hist *domain.Histogram)
 
 	return nil
 }
+
+// txtMetadata — сведения о результатах в текстовом формате (аналог
+// глобальных атрибутов NetCDF)
+type txtMetadata struct {
+	Source  string `yaml:"source"`
+	History string `yaml:"history"`
+	// Averaging — способ усреднения лучших решений, которым получены основные
+	// продукты (только в режиме montecarlo)
+	Averaging string         `yaml:"averaging,omitempty"`
+	Config    *domain.Config `yaml:"config"`
+}
+
+// WriteMetadata записывает в YAML-файл сведения о результатах: способ
+// усреднения и полную конфигурацию, с которой они получены
+func (w *TXTFileWriter) WriteMetadata(filename string, config *domain.Config) error {
+	metadata := txtMetadata{
+		Source:  "lidar-classification",
+		History: time.Now().UTC().Format(time.RFC3339) + " created by lidar-classification",
+		Config:  config,
+	}
+	if config.GetMode() == domain.ModeMonteCarlo {
+		metadata.Averaging = config.Averaging
+	}
+
+	text, err := yaml.Marshal(&metadata)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, text, 0o644)
+}
@@ -0,0 +1,276 @@
+package infrastructure
+
+import (
+	"fmt"
+	"lidar-classification/internal/domain"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/batchatco/go-native-netcdf/netcdf"
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"go.uber.org/zap"
+)
+
+// NetCDFFileReader читает матрицу из переменной NetCDF-файла (CDF или NetCDF-4/HDF5).
+// Переменная должна быть двумерной и определяться на измерениях координатных
+// переменных высоты и времени (в любом порядке).
+type NetCDFFileReader struct {
+	logger      *zap.Logger
+	variable    string
+	altitudeVar string
+	timeVar     string
+}
+
+func NewNetCDFFileReader(logger *zap.Logger, variable, altitudeVar, timeVar string) *NetCDFFileReader {
+	return &NetCDFFileReader{
+		logger:      logger,
+		variable:    variable,
+		altitudeVar: altitudeVar,
+		timeVar:     timeVar,
+	}
+}
+
+func (r *NetCDFFileReader) ReadMatrix(filename string) (*domain.MatrixData, error) {
+	nc, err := netcdf.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	defer nc.Close()
+
+	heightLabels, altDim, err := r.readAltitude(nc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	timeLabels, timeDim, err := r.readTime(nc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	v, err := nc.GetVariable(r.variable)
+	if err != nil {
+		return nil, fmt.Errorf("%s: variable %q: %w", filename, r.variable, err)
+	}
+	if len(v.Dimensions) != 2 {
+		return nil, fmt.Errorf("%s: variable %q must have 2 dimensions, got %d: %w",
+			filename, r.variable, len(v.Dimensions), domain.ErrInvalidFileFormat)
+	}
+
+	raw, err := toFloat2D(v.Values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: variable %q: %w", filename, r.variable, err)
+	}
+
+	// Приводим к виду [высота][время]
+	var data [][]float64
+	switch {
+	case v.Dimensions[0] == altDim && v.Dimensions[1] == timeDim:
+		data = raw
+	case v.Dimensions[0] == timeDim && v.Dimensions[1] == altDim:
+		data = transpose(raw)
+	default:
+		return nil, fmt.Errorf("%s: variable %q has dimensions %v, expected (%s, %s): %w",
+			filename, r.variable, v.Dimensions, altDim, timeDim, domain.ErrInvalidFileFormat)
+	}
+
+	if len(data) != len(heightLabels) || len(data) == 0 || len(data[0]) != len(timeLabels) {
+		return nil, fmt.Errorf("%s: variable %q does not match coordinate sizes: %w",
+			filename, r.variable, domain.ErrInvalidFileFormat)
+	}
+
+	r.applyPacking(data, v.Attributes)
+
+	return &domain.MatrixData{
+		HeightLabels: heightLabels,
+		TimeLabels:   timeLabels,
+		Data:         data,
+		Rows:         len(data),
+		Cols:         len(data[0]),
+	}, nil
+}
+
+// IsNetCDFFile сообщает, следует ли читать файл как NetCDF (по расширению)
+func IsNetCDFFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".nc", ".nc4", ".cdf", ".netcdf":
+		return true
+	default:
+		return false
+	}
+}
+
+// readAltitude читает координатную переменную высоты и возвращает её значения и имя измерения.
+func (r *NetCDFFileReader) readAltitude(nc api.Group) ([]float64, string, error) {
+	v, err := nc.GetVariable(r.altitudeVar)
+	if err != nil {
+		return nil, "", fmt.Errorf("altitude variable %q: %w", r.altitudeVar, err)
+	}
+	if len(v.Dimensions) != 1 {
+		return nil, "", fmt.Errorf("altitude variable %q must be one-dimensional: %w",
+			r.altitudeVar, domain.ErrInvalidFileFormat)
+	}
+
+	values, err := toFloat1D(v.Values)
+	if err != nil {
+		return nil, "", fmt.Errorf("altitude variable %q: %w", r.altitudeVar, err)
+	}
+	return values, v.Dimensions[0], nil
+}
+
+// readTime читает координатную переменную времени. Числовые значения
+// переводятся в строковые метки, символьные используются как есть.
+func (r *NetCDFFileReader) readTime(nc api.Group) ([]string, string, error) {
+	v, err := nc.GetVariable(r.timeVar)
+	if err != nil {
+		return nil, "", fmt.Errorf("time variable %q: %w", r.timeVar, err)
+	}
+	if len(v.Dimensions) == 0 {
+		return nil, "", fmt.Errorf("time variable %q must be one-dimensional: %w",
+			r.timeVar, domain.ErrInvalidFileFormat)
+	}
+
+	if labels, ok := v.Values.([]string); ok {
+		for i := range labels {
+			labels[i] = strings.TrimSpace(labels[i])
+		}
+		return labels, v.Dimensions[0], nil
+	}
+
+	if len(v.Dimensions) != 1 {
+		return nil, "", fmt.Errorf("time variable %q must be one-dimensional: %w",
+			r.timeVar, domain.ErrInvalidFileFormat)
+	}
+
+	values, err := toFloat1D(v.Values)
+	if err != nil {
+		return nil, "", fmt.Errorf("time variable %q: %w", r.timeVar, err)
+	}
+	labels := make([]string, len(values))
+	for i, val := range values {
+		labels[i] = strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return labels, v.Dimensions[0], nil
+}
+
+// applyPacking заменяет значения _FillValue/missing_value на NaN и применяет
+// scale_factor и add_offset согласно соглашениям CF.
+func (r *NetCDFFileReader) applyPacking(data [][]float64, attrs api.AttributeMap) {
+	var fills []float64
+	scale, offset := 1.0, 0.0
+	if attrs != nil {
+		for _, name := range []string{"_FillValue", "missing_value"} {
+			if val, ok := attrs.Get(name); ok {
+				if values, err := toFloat1D(val); err == nil {
+					fills = append(fills, values...)
+				}
+			}
+		}
+		if val, ok := attrs.Get("scale_factor"); ok {
+			if values, err := toFloat1D(val); err == nil && len(values) > 0 {
+				scale = values[0]
+			}
+		}
+		if val, ok := attrs.Get("add_offset"); ok {
+			if values, err := toFloat1D(val); err == nil && len(values) > 0 {
+				offset = values[0]
+			}
+		}
+	}
+
+	for i, row := range data {
+		for j, value := range row {
+			if isFill(value, fills) {
+				data[i][j] = math.NaN()
+				continue
+			}
+			value = value*scale + offset
+			if value < 0 {
+				r.logger.Warn("Negative value found, replaced with NaN", zap.Float64("value", value))
+				value = math.NaN()
+			}
+			data[i][j] = value
+		}
+	}
+}
+
+func isFill(value float64, fills []float64) bool {
+	if math.IsNaN(value) {
+		return true
+	}
+	for _, fill := range fills {
+		if value == fill {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat1D приводит скаляр или одномерный срез числового типа к []float64.
+func toFloat1D(values any) ([]float64, error) {
+	rv := reflect.ValueOf(values)
+	if rv.Kind() != reflect.Slice {
+		f, ok := numberToFloat(rv)
+		if !ok {
+			return nil, fmt.Errorf("unsupported value type %T: %w", values, domain.ErrInvalidFileFormat)
+		}
+		return []float64{f}, nil
+	}
+
+	result := make([]float64, rv.Len())
+	for i := range result {
+		f, ok := numberToFloat(rv.Index(i))
+		if !ok {
+			return nil, fmt.Errorf("unsupported value type %T: %w", values, domain.ErrInvalidFileFormat)
+		}
+		result[i] = f
+	}
+	return result, nil
+}
+
+// toFloat2D приводит двумерный срез числового типа к [][]float64.
+func toFloat2D(values any) ([][]float64, error) {
+	rv := reflect.ValueOf(values)
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("unsupported value type %T: %w", values, domain.ErrInvalidFileFormat)
+	}
+
+	result := make([][]float64, rv.Len())
+	for i := range result {
+		row, err := toFloat1D(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		result[i] = row
+	}
+	return result, nil
+}
+
+func numberToFloat(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	default:
+		return 0, false
+	}
+}
+
+func transpose(data [][]float64) [][]float64 {
+	if len(data) == 0 {
+		return data
+	}
+	result := make([][]float64, len(data[0]))
+	for j := range result {
+		result[j] = make([]float64, len(data))
+		for i := range data {
+			result[j][i] = data[i][j]
+		}
+	}
+	return result
+}
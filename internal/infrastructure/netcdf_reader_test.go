@@ -0,0 +1,212 @@
+package infrastructure
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf"
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+	"go.uber.org/zap"
+
+	"lidar-classification/internal/domain"
+)
+
+// testVar — переменная тестового NetCDF-файла
+type testVar struct {
+	name  string
+	dims  []string
+	value any
+	attrs map[string]any
+}
+
+// writeTestNetCDF записывает переменные vars в файл classic CDF
+func writeTestNetCDF(t *testing.T, filename string, vars ...testVar) {
+	t.Helper()
+	nc, err := netcdf.OpenWriter(filename, netcdf.KindCDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vars {
+		keys := make([]string, 0, len(v.attrs))
+		for key := range v.attrs {
+			keys = append(keys, key)
+		}
+		attrs, err := util.NewOrderedMap(keys, v.attrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := nc.AddVar(v.name, api.Variable{Values: v.value, Dimensions: v.dims, Attributes: attrs}); err != nil {
+			t.Fatalf("variable %q: %v", v.name, err)
+		}
+	}
+	if err := nc.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testInputFile записывает файл с координатами высоты (3 уровня) и времени
+// (2 профиля) и матрицами с нестандартными именами: деполяризация на
+// (height, profile) с пропусками и преобразованный в int16 показатель
+// преломления на (profile, height)
+func testInputFile(t *testing.T) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "input.nc")
+	writeTestNetCDF(t, filename,
+		testVar{name: "height", dims: []string{"height"}, value: []float64{500, 1000, 1500}},
+		testVar{name: "profile", dims: []string{"profile"}, value: []float64{0, 600}},
+		testVar{
+			name:  "dep_custom",
+			dims:  []string{"height", "profile"},
+			value: [][]float64{{10, -999}, {math.NaN(), 20}, {30, 40}},
+			// Библиотека не записывает атрибуты с подчеркиванием (_FillValue),
+			// а reader обрабатывает missing_value так же
+			attrs: map[string]any{"missing_value": -999.0},
+		},
+		testVar{
+			name:  "mre_packed",
+			dims:  []string{"profile", "height"},
+			value: [][]int16{{100, 200, 300}, {400, 500, -1}},
+			attrs: map[string]any{"scale_factor": 0.001, "add_offset": 1.3, "missing_value": int16(-1)},
+		},
+	)
+	return filename
+}
+
+// checkMatrix сравнивает матрицу с ожидаемой; NaN в want означает пропуск
+func checkMatrix(t *testing.T, got *domain.MatrixData, want [][]float64) {
+	t.Helper()
+	if got.Rows != len(want) || got.Cols != len(want[0]) {
+		t.Fatalf("size %dx%d, want %dx%d", got.Rows, got.Cols, len(want), len(want[0]))
+	}
+	for i := range want {
+		for j := range want[i] {
+			g, w := got.Data[i][j], want[i][j]
+			if math.IsNaN(w) != math.IsNaN(g) || (!math.IsNaN(w) && math.Abs(g-w) > 1e-9) {
+				t.Errorf("data[%d][%d] = %g, want %g", i, j, g, w)
+			}
+		}
+	}
+}
+
+func TestNetCDFFileReaderReadMatrix(t *testing.T) {
+	filename := testInputFile(t)
+	nan := math.NaN()
+
+	tests := []struct {
+		name     string
+		variable string
+		want     [][]float64
+	}{
+		{
+			name:     "altitude by time with fill values",
+			variable: "dep_custom",
+			want:     [][]float64{{10, nan}, {nan, 20}, {30, 40}},
+		},
+		{
+			name:     "time by altitude with packing",
+			variable: "mre_packed",
+			want:     [][]float64{{1.4, 1.7}, {1.5, 1.8}, {1.6, nan}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewNetCDFFileReader(zap.NewNop(), tt.variable, "height", "profile")
+			got, err := reader.ReadMatrix(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.HeightLabels) != 3 || got.HeightLabels[0] != 500 || got.HeightLabels[2] != 1500 {
+				t.Errorf("height labels = %v, want [500 1000 1500]", got.HeightLabels)
+			}
+			if strings.Join(got.TimeLabels, " ") != "0 600" {
+				t.Errorf("time labels = %v, want [0 600]", got.TimeLabels)
+			}
+			checkMatrix(t, got, tt.want)
+		})
+	}
+}
+
+// TestNetCDFFileReaderConfigFallback проверяет, что при заданном netcdf.file
+// входные матрицы читаются из него по именам переменных netcdf.*_var
+func TestNetCDFFileReaderConfigFallback(t *testing.T) {
+	filename := testInputFile(t)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	text := "components:\n" +
+		"  - {name: d, LR: 49, CV: 0.07, Gf_range: [1e-5, 1e-4], m_range: [1.40, 1.45], delta_range: [0.20, 0.35]}\n" +
+		"  - {name: s, LR: 65, CV: 0.085, Gf_range: [2e-4, 1e-3], m_range: [1.51, 1.54], delta_range: [0.01, 0.10]}\n" +
+		"netcdf:\n" +
+		"  file: " + filename + "\n" +
+		"  altitude_var: height\n" +
+		"  time_var: profile\n" +
+		"  dep_var: dep_custom\n" +
+		"  mre_var: mre_packed\n"
+	if err := os.WriteFile(configFile, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewYAMLConfigReader(zap.NewNop(), nil).ReadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Input.Dep != filename || config.Input.Mre != filename {
+		t.Fatalf("inputs = %q, %q, want %q", config.Input.Dep, config.Input.Mre, filename)
+	}
+
+	vars := config.NetCDF
+	dep, err := NewNetCDFFileReader(zap.NewNop(), vars.DepVar, vars.AltitudeVar, vars.TimeVar).ReadMatrix(config.Input.Dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMatrix(t, dep, [][]float64{{10, math.NaN()}, {math.NaN(), 20}, {30, 40}})
+
+	mre, err := NewNetCDFFileReader(zap.NewNop(), vars.MreVar, vars.AltitudeVar, vars.TimeVar).ReadMatrix(config.Input.Mre)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMatrix(t, mre, [][]float64{{1.4, 1.7}, {1.5, 1.8}, {1.6, math.NaN()}})
+}
+
+func TestNetCDFFileReaderErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "input.nc")
+	writeTestNetCDF(t, filename,
+		testVar{name: "altitude", dims: []string{"altitude"}, value: []float64{500, 1000}},
+		testVar{name: "time", dims: []string{"time"}, value: []float64{0, 600, 1200}},
+		testVar{name: "profile_1d", dims: []string{"altitude"}, value: []float64{1, 2}},
+		testVar{name: "other_grid", dims: []string{"altitude", "channel"}, value: [][]float64{{1, 2}, {3, 4}}},
+	)
+
+	tests := []struct {
+		name     string
+		variable string
+		timeVar  string
+		wantErr  error
+		message  string
+	}{
+		{name: "missing variable", variable: "depolarization", timeVar: "time", message: `variable "depolarization"`},
+		{name: "missing coordinate", variable: "other_grid", timeVar: "profile", message: `time variable "profile"`},
+		{name: "one-dimensional variable", variable: "profile_1d", timeVar: "time", wantErr: domain.ErrInvalidFileFormat},
+		{name: "shape mismatch", variable: "other_grid", timeVar: "time", wantErr: domain.ErrInvalidFileFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewNetCDFFileReader(zap.NewNop(), tt.variable, "altitude", tt.timeVar)
+			_, err := reader.ReadMatrix(filename)
+			if err == nil {
+				t.Fatal("want error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("error %q does not mention %q", err, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package infrastructure
+
+import (
+	"errors"
+	"fmt"
+	"lidar-classification/internal/domain"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/batchatco/go-native-netcdf/netcdf"
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	altitudeDim = "altitude"
+	timeDim     = "time"
+)
+
+// NetCDFFileWriter записывает все продукты классификации в один NetCDF-файл
+// (classic CDF) в соответствии с соглашениями CF.
+type NetCDFFileWriter struct {
+	logger *zap.Logger
+}
+
+func NewNetCDFFileWriter(logger *zap.Logger) *NetCDFFileWriter {
+	return &NetCDFFileWriter{logger: logger}
+}
+
+// WriteResults записывает каждый продукт из results как переменную на общих
+// измерениях (altitude, time). Конфигурация расчета сохраняется в глобальных атрибутах.
+func (w *NetCDFFileWriter) WriteResults(filename string, results domain.ClassifyResults, config *domain.Config) error {
+	if len(results) == 0 {
+		return errors.New("no results to write")
+	}
+
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	labels := results[names[0]]
+
+	nc, err := netcdf.OpenWriter(filename, netcdf.KindCDF)
+	if err != nil {
+		return err
+	}
+
+	if err := w.addCoordinates(nc, labels); err != nil {
+		nc.Close()
+		return err
+	}
+
+	var components []domain.Component
+	if config != nil {
+		components = config.Components
+	}
+
+	for _, name := range names {
+		data := results[name]
+		if data.Rows != labels.Rows || data.Cols != labels.Cols {
+			nc.Close()
+			return fmt.Errorf("product %q has size %dx%d, expected %dx%d",
+				name, data.Rows, data.Cols, labels.Rows, labels.Cols)
+		}
+
+		longName, units := domain.ProductInfo(name, components)
+		keys := []string{"long_name", "units"}
+		values := map[string]any{
+			"long_name": longName,
+			"units":     units,
+		}
+		if name == domain.TypeMapProduct && config != nil {
+			// Легенда категориального продукта по соглашениям CF
+			classes := config.TypeClasses()
+			flagValues := make([]float64, len(classes))
+			flagMeanings := make([]string, len(classes))
+			for k, class := range classes {
+				flagValues[k] = float64(class.Code)
+				flagMeanings[k] = class.Name
+			}
+			keys = append(keys, "flag_values", "flag_meanings")
+			values["flag_values"] = flagValues
+			values["flag_meanings"] = strings.Join(flagMeanings, " ")
+		}
+		attrs, err := util.NewOrderedMap(keys, values)
+		if err != nil {
+			nc.Close()
+			return err
+		}
+
+		if err := nc.AddVar(name, api.Variable{
+			Values:     data.Data,
+			Dimensions: []string{altitudeDim, timeDim},
+			Attributes: attrs,
+		}); err != nil {
+			nc.Close()
+			return fmt.Errorf("variable %q: %w", name, err)
+		}
+	}
+
+	globalAttrs, err := w.globalAttributes(config)
+	if err != nil {
+		nc.Close()
+		return err
+	}
+	if err := nc.AddAttributes(globalAttrs); err != nil {
+		nc.Close()
+		return err
+	}
+
+	return nc.Close()
+}
+
+// addCoordinates добавляет координатные переменные высоты и времени.
+// Нечисловые метки времени записываются только в символьную переменную
+// time_label, а time содержит порядковые номера профилей.
+func (w *NetCDFFileWriter) addCoordinates(nc api.Writer, labels *domain.MatrixData) error {
+	altAttrs, err := util.NewOrderedMap(
+		[]string{"standard_name", "long_name", "units", "axis", "positive"},
+		map[string]any{
+			"standard_name": "altitude",
+			"long_name":     "altitude",
+			"units":         "m",
+			"axis":          "Z",
+			"positive":      "up",
+		})
+	if err != nil {
+		return err
+	}
+	if err := nc.AddVar(altitudeDim, api.Variable{
+		Values:     labels.HeightLabels,
+		Dimensions: []string{altitudeDim},
+		Attributes: altAttrs,
+	}); err != nil {
+		return err
+	}
+
+	// Единицы числовых меток неизвестны, поэтому axis и units не задаются:
+	// переменная time не объявляется временной координатой CF
+	timeValues, numeric := parseTimeLabels(labels.TimeLabels)
+	longName := "time"
+	if !numeric {
+		longName = "time index"
+	}
+	timeAttrs, err := util.NewOrderedMap(
+		[]string{"long_name"},
+		map[string]any{"long_name": longName})
+	if err != nil {
+		return err
+	}
+	if err := nc.AddVar(timeDim, api.Variable{
+		Values:     timeValues,
+		Dimensions: []string{timeDim},
+		Attributes: timeAttrs,
+	}); err != nil {
+		return err
+	}
+	if numeric {
+		return nil
+	}
+
+	labelAttrs, err := util.NewOrderedMap(
+		[]string{"long_name"},
+		map[string]any{"long_name": "time label"})
+	if err != nil {
+		return err
+	}
+	return nc.AddVar("time_label", api.Variable{
+		Values:     labels.TimeLabels,
+		Dimensions: []string{timeDim},
+		Attributes: labelAttrs,
+	})
+}
+
+// parseTimeLabels переводит метки времени в числа. Если хотя бы одна метка
+// нечисловая, возвращаются порядковые номера и false.
+func parseTimeLabels(labels []string) ([]float64, bool) {
+	values := make([]float64, len(labels))
+	for i, label := range labels {
+		value, err := strconv.ParseFloat(label, 64)
+		if err != nil {
+			for k := range values {
+				values[k] = float64(k)
+			}
+			return values, false
+		}
+		values[i] = value
+	}
+	return values, true
+}
+
+// globalAttributes формирует глобальные атрибуты: сведения о файле, полный
+// YAML конфигурации и её отдельные параметры с префиксом config_.
+func (w *NetCDFFileWriter) globalAttributes(config *domain.Config) (*util.OrderedMap, error) {
+	keys := []string{"Conventions", "title", "source", "history"}
+	values := map[string]any{
+		"Conventions": "CF-1.8",
+		"title":       "Aerosol classification results",
+		"source":      "lidar-classification",
+		"history":     time.Now().UTC().Format(time.RFC3339) + " created by lidar-classification",
+	}
+
+	if config == nil {
+		return util.NewOrderedMap(keys, values)
+	}
+
+	text, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.GetMode() == domain.ModeMonteCarlo {
+		// Способ усреднения лучших решений, которым получены основные продукты
+		keys = append(keys, "averaging")
+		values["averaging"] = config.Averaging
+	}
+	keys = append(keys, "config")
+	values["config"] = string(text)
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(text, &node); err != nil {
+		return nil, err
+	}
+	if len(node.Content) > 0 {
+		flattenConfigNode(node.Content[0], "config", &keys, values)
+	}
+
+	return util.NewOrderedMap(keys, values)
+}
+
+// flattenConfigNode раскладывает узел YAML в плоский набор атрибутов NetCDF.
+func flattenConfigNode(node *yaml.Node, prefix string, keys *[]string, values map[string]any) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := prefix + "_" + node.Content[i].Value
+			flattenConfigNode(node.Content[i+1], name, keys, values)
+		}
+
+	case yaml.SequenceNode:
+		numbers := make([]float64, 0, len(node.Content))
+		items := make([]string, 0, len(node.Content))
+		numeric := true
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				for k, child := range node.Content {
+					flattenConfigNode(child, prefix+"_"+strconv.Itoa(k), keys, values)
+				}
+				return
+			}
+			items = append(items, item.Value)
+			value, err := strconv.ParseFloat(item.Value, 64)
+			if err != nil || (item.Tag != "!!int" && item.Tag != "!!float") {
+				numeric = false
+			}
+			numbers = append(numbers, value)
+		}
+		if len(items) == 0 {
+			return
+		}
+		*keys = append(*keys, prefix)
+		if numeric {
+			values[prefix] = numbers
+		} else {
+			values[prefix] = strings.Join(items, ", ")
+		}
+
+	case yaml.ScalarNode:
+		if node.Value == "" {
+			return
+		}
+		*keys = append(*keys, prefix)
+		switch node.Tag {
+		case "!!int":
+			value, err := strconv.ParseInt(node.Value, 0, 64)
+			if err == nil && value >= math.MinInt32 && value <= math.MaxInt32 {
+				values[prefix] = int32(value)
+			} else {
+				values[prefix] = node.Value
+			}
+		case "!!float":
+			value, err := strconv.ParseFloat(node.Value, 64)
+			if err == nil {
+				values[prefix] = value
+			} else {
+				values[prefix] = node.Value
+			}
+		default:
+			values[prefix] = node.Value
+		}
+	}
+}
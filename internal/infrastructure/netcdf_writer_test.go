@@ -0,0 +1,93 @@
+package infrastructure
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf"
+	"go.uber.org/zap"
+
+	"lidar-classification/internal/domain"
+)
+
+// TestNetCDFFileWriterRoundTrip записывает продукты и читает их обратно
+// NetCDFFileReader для числовых и нечисловых меток времени
+func TestNetCDFFileWriterRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeLabels []string
+		// timeVar — переменная, из которой метки читаются как есть
+		timeVar   string
+		wantIndex []string
+	}{
+		{name: "numeric labels", timeLabels: []string{"0", "600.5"}, timeVar: "time"},
+		{name: "string labels", timeLabels: []string{"12:00", "12:10"}, timeVar: "time_label", wantIndex: []string{"0", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := func(data [][]float64) *domain.MatrixData {
+				return &domain.MatrixData{
+					HeightLabels: []float64{500, 1000, 1500},
+					TimeLabels:   tt.timeLabels,
+					Data:         data,
+					Rows:         3,
+					Cols:         2,
+				}
+			}
+			results := domain.ClassifyResults{
+				"n_d":       product([][]float64{{0.1, 0.2}, {math.NaN(), 0.4}, {0.5, 0.6}}),
+				"residuals": product([][]float64{{1e-3, 2e-3}, {3e-3, 4e-3}, {5e-3, math.NaN()}}),
+			}
+			filename := filepath.Join(t.TempDir(), "results.nc")
+			if err := NewNetCDFFileWriter(zap.NewNop()).WriteResults(filename, results, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range results {
+				got, err := NewNetCDFFileReader(zap.NewNop(), name, altitudeDim, tt.timeVar).ReadMatrix(filename)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if strings.Join(got.TimeLabels, " ") != strings.Join(tt.timeLabels, " ") {
+					t.Errorf("%s: time labels = %q, want %q", name, got.TimeLabels, tt.timeLabels)
+				}
+				for i, h := range want.HeightLabels {
+					if got.HeightLabels[i] != h {
+						t.Errorf("%s: height labels = %v, want %v", name, got.HeightLabels, want.HeightLabels)
+						break
+					}
+				}
+				checkMatrix(t, got, want.Data)
+			}
+
+			nc, err := netcdf.Open(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer nc.Close()
+			timeVar, err := nc.GetVariable(timeDim)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := timeVar.Attributes.Get("axis"); ok {
+				t.Error("time variable has axis attribute without time units")
+			}
+			_, err = nc.GetVariable("time_label")
+			if hasLabels := err == nil; hasLabels != (tt.wantIndex != nil) {
+				t.Errorf("time_label present = %v, want %v", hasLabels, tt.wantIndex != nil)
+			}
+			if tt.wantIndex != nil {
+				index, err := NewNetCDFFileReader(zap.NewNop(), "n_d", altitudeDim, timeDim).ReadMatrix(filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.Join(index.TimeLabels, " ") != strings.Join(tt.wantIndex, " ") {
+					t.Errorf("time = %q, want profile numbers %q", index.TimeLabels, tt.wantIndex)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package infrastructure
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ttyRefresh — наименьший период обновления строки хода обработки в терминале
+const ttyRefresh = 200 * time.Millisecond
+
+// ProgressReporter показывает ход обработки точек: число обработанных точек,
+// из них с решением и без, скорость и оценку оставшегося времени. В терминале
+// строка обновляется на месте, иначе раз в interval пишется запись в журнал.
+// Методы вызываются из одной горутины.
+type ProgressReporter struct {
+	logger   *zap.Logger
+	out      io.Writer
+	tty      bool
+	interval time.Duration
+
+	total, done, valid int
+	start, last        time.Time
+}
+
+func NewProgressReporter(logger *zap.Logger, out *os.File, interval time.Duration) *ProgressReporter {
+	return &ProgressReporter{
+		logger:   logger,
+		out:      out,
+		tty:      isTerminal(out),
+		interval: interval,
+	}
+}
+
+// isTerminal проверяет, что файл является терминалом: символьным устройством,
+// отличным от os.DevNull
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+func (p *ProgressReporter) Start(total int) {
+	p.total, p.done, p.valid = total, 0, 0
+	p.start = time.Now()
+	p.last = p.start
+	if p.tty {
+		p.print()
+	}
+}
+
+// Add учитывает обработанную точку; valid — найдено ли решение
+func (p *ProgressReporter) Add(valid bool) {
+	p.done++
+	if valid {
+		p.valid++
+	}
+
+	refresh := p.interval
+	if p.tty {
+		refresh = ttyRefresh
+	}
+	if time.Since(p.last) < refresh {
+		return
+	}
+	p.last = time.Now()
+	if p.tty {
+		p.print()
+	} else {
+		p.log("Progress")
+	}
+}
+
+func (p *ProgressReporter) Finish() {
+	if p.tty {
+		p.print()
+		fmt.Fprintln(p.out)
+	}
+	p.log("Processing finished")
+}
+
+// print перерисовывает строку хода обработки в терминале
+func (p *ProgressReporter) print() {
+	rate, eta := p.estimate()
+	percent := 100.0
+	if p.total > 0 {
+		percent = 100 * float64(p.done) / float64(p.total)
+	}
+	etaText := "--"
+	if eta >= 0 {
+		etaText = eta.Round(time.Second).String()
+	}
+	fmt.Fprintf(p.out, "\rpoints %d/%d (%.1f%%)  valid %d  invalid %d  %.1f points/s  ETA %s\033[K",
+		p.done, p.total, percent, p.valid, p.done-p.valid, rate, etaText)
+}
+
+func (p *ProgressReporter) log(msg string) {
+	rate, eta := p.estimate()
+	fields := []zap.Field{
+		zap.Int("done", p.done),
+		zap.Int("total", p.total),
+		zap.Int("valid", p.valid),
+		zap.Int("invalid", p.done-p.valid),
+		zap.Float64("points_per_second", rate),
+		zap.Duration("elapsed", time.Since(p.start).Round(time.Second)),
+	}
+	if eta >= 0 {
+		fields = append(fields, zap.Duration("eta", eta.Round(time.Second)))
+	}
+	p.logger.Info(msg, fields...)
+}
+
+// estimate возвращает скорость обработки (точек в секунду) и оценку оставшегося
+// времени; оценка отрицательна, пока ни одна точка не обработана
+func (p *ProgressReporter) estimate() (float64, time.Duration) {
+	elapsed := time.Since(p.start).Seconds()
+	if p.done == 0 || elapsed <= 0 {
+		return 0, -1
+	}
+	rate := float64(p.done) / elapsed
+	return rate, time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+}
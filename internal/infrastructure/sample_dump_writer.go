@@ -0,0 +1,217 @@
+package infrastructure
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"lidar-classification/internal/domain"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// SampleDumpWriter записывает все выборки точки в файл <prefix>samples_<i>_<j>.<format>
+// каталога dir в формате json или csv. Деполяризация записывается не штрихованной,
+// как в продуктах delta_*.
+type SampleDumpWriter struct {
+	logger     *zap.Logger
+	dir        string
+	prefix     string
+	format     string
+	components []domain.Component
+}
+
+func NewSampleDumpWriter(logger *zap.Logger, dir, prefix, format string, components []domain.Component) *SampleDumpWriter {
+	return &SampleDumpWriter{
+		logger:     logger,
+		dir:        dir,
+		prefix:     prefix,
+		format:     format,
+		components: components,
+	}
+}
+
+func (w *SampleDumpWriter) WriteSamples(dump *domain.SampleDump) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("%ssamples_%d_%d.%s", w.prefix, dump.Data.I, dump.Data.J, w.format))
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	if w.format == "csv" {
+		err = w.writeCSV(writer, dump)
+	} else {
+		err = w.writeJSON(writer, dump)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	// Ошибка отложенной записи может проявиться только при закрытии файла
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	w.logger.Info("Successfully written samples",
+		zap.String("file", filename),
+		zap.Int("samples", len(dump.Samples)))
+	return nil
+}
+
+// jsonFloat записывает нечисловые значения (NaN, ±Inf) как null
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return []byte("null"), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+}
+
+func jsonFloats(values []float64) []jsonFloat {
+	out := make([]jsonFloat, len(values))
+	for k, v := range values {
+		out[k] = jsonFloat(v)
+	}
+	return out
+}
+
+type jsonMeasurement struct {
+	Delta    jsonFloat `json:"delta"`
+	Gf       jsonFloat `json:"gf"`
+	Mre      jsonFloat `json:"mre"`
+	DeltaErr jsonFloat `json:"delta_err"`
+	GfErr    jsonFloat `json:"gf_err"`
+	MreErr   jsonFloat `json:"mre_err"`
+}
+
+type jsonSample struct {
+	Attempt    int         `json:"attempt"`
+	Valid      bool        `json:"valid"`
+	Best       bool        `json:"best"`
+	Residual   jsonFloat   `json:"residual"`
+	Iterations int         `json:"iterations"`
+	Converged  bool        `json:"converged"`
+	Fractions  []jsonFloat `json:"n"`
+	Gf         []jsonFloat `json:"GF"`
+	Delta      []jsonFloat `json:"delta"`
+	Mre        []jsonFloat `json:"mre"`
+}
+
+type jsonDump struct {
+	I           int             `json:"i"`
+	J           int             `json:"j"`
+	Altitude    jsonFloat       `json:"altitude"`
+	Time        string          `json:"time"`
+	Measurement jsonMeasurement `json:"measurement"`
+	Components  []string        `json:"components"`
+	Samples     []jsonSample    `json:"samples"`
+}
+
+func (w *SampleDumpWriter) writeJSON(writer *bufio.Writer, dump *domain.SampleDump) error {
+	data := dump.Data
+	// Обратный пересчет delta = delta'/(1-delta'), погрешность — линеаризацией
+	delta := data.DeltaPrime / (1 - data.DeltaPrime)
+	out := jsonDump{
+		I:        data.I,
+		J:        data.J,
+		Altitude: jsonFloat(dump.Altitude),
+		Time:     dump.Time,
+		Measurement: jsonMeasurement{
+			Delta:    jsonFloat(delta),
+			Gf:       jsonFloat(data.Gf),
+			Mre:      jsonFloat(data.M),
+			DeltaErr: jsonFloat(data.DeltaPrimeErr * (1 + delta) * (1 + delta)),
+			GfErr:    jsonFloat(data.GfErr),
+			MreErr:   jsonFloat(data.MErr),
+		},
+		Components: make([]string, len(w.components)),
+		Samples:    make([]jsonSample, len(dump.Samples)),
+	}
+	for k, comp := range w.components {
+		out.Components[k] = comp.Name
+	}
+	for k, sample := range dump.Samples {
+		gf, delta, mre := splitParameters(sample.Parameters)
+		out.Samples[k] = jsonSample{
+			Attempt:    sample.Attempt,
+			Valid:      sample.Valid,
+			Best:       sample.Best,
+			Residual:   jsonFloat(sample.Residual),
+			Iterations: sample.Iterations,
+			Converged:  sample.Converged,
+			Fractions:  jsonFloats(sample.Fractions),
+			Gf:         jsonFloats(gf),
+			Delta:      jsonFloats(delta),
+			Mre:        jsonFloats(mre),
+		}
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// writeCSV записывает по строке на выборку; столбцы долей и параметров
+// называются как продукты (n_<name>, GF_<name>, delta_<name>, mre_<name>)
+func (w *SampleDumpWriter) writeCSV(writer *bufio.Writer, dump *domain.SampleDump) error {
+	out := csv.NewWriter(writer)
+
+	header := []string{"attempt", "valid", "best", "residual", "iterations", "converged"}
+	for _, prefix := range []string{"n", "GF", "delta", "mre"} {
+		for _, comp := range w.components {
+			header = append(header, prefix+"_"+comp.Name)
+		}
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	for _, sample := range dump.Samples {
+		record := []string{
+			strconv.Itoa(sample.Attempt),
+			strconv.FormatBool(sample.Valid),
+			strconv.FormatBool(sample.Best),
+			formatFloat(sample.Residual),
+			strconv.Itoa(sample.Iterations),
+			strconv.FormatBool(sample.Converged),
+		}
+		gf, delta, mre := splitParameters(sample.Parameters)
+		for _, values := range [][]float64{sample.Fractions, gf, delta, mre} {
+			for _, v := range values {
+				record = append(record, formatFloat(v))
+			}
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// splitParameters раскладывает параметры компонент по величинам;
+// деполяризация пересчитывается из штрихованной
+func splitParameters(p domain.Parameters) (gf, delta, mre []float64) {
+	gf = make([]float64, len(p))
+	delta = make([]float64, len(p))
+	mre = make([]float64, len(p))
+	for k, cp := range p {
+		gf[k] = cp.Gf
+		delta[k] = cp.DeltaPrime / (1 - cp.DeltaPrime)
+		mre[k] = cp.Mre
+	}
+	return gf, delta, mre
+}
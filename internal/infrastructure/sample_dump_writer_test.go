@@ -0,0 +1,131 @@
+package infrastructure
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"lidar-classification/internal/domain"
+)
+
+// testSampleDump возвращает дамп точки (1, 2) с двумя компонентами и двумя
+// выборками; невязка второй выборки не определена
+func testSampleDump() *domain.SampleDump {
+	params := domain.Parameters{
+		{Gf: 5e-5, DeltaPrime: 0.2, Mre: 1.42},
+		{Gf: 5e-4, DeltaPrime: 0.5, Mre: 1.52},
+	}
+	return &domain.SampleDump{
+		Data: domain.PointData{
+			I: 1, J: 2,
+			DeltaPrime: 0.1, Gf: 2e-4, M: 1.47,
+			DeltaPrimeErr: math.NaN(), GfErr: 1e-5, MErr: math.NaN(),
+		},
+		Altitude: 1500,
+		Time:     "12:10",
+		Samples: []domain.SampleRecord{
+			{Attempt: 1, Parameters: params, Fractions: domain.Fractions{0.3, 0.7}, Residual: 0.02,
+				Iterations: 35, Converged: true, Valid: true, Best: true},
+			{Attempt: 2, Parameters: params, Fractions: domain.Fractions{0.6, 0.4}, Residual: math.NaN(),
+				Iterations: 200},
+		},
+	}
+}
+
+var testDumpComponents = []domain.Component{{Name: "d"}, {Name: "s"}}
+
+// writeTestDump записывает testSampleDump в формате format и возвращает содержимое файла
+func writeTestDump(t *testing.T, format string) []byte {
+	t.Helper()
+	dir := t.TempDir()
+	writer := NewSampleDumpWriter(zap.NewNop(), dir, "run_", format, testDumpComponents)
+	if err := writer.WriteSamples(testSampleDump()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "run_samples_1_2."+format))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSampleDumpWriterJSON(t *testing.T) {
+	var got struct {
+		I, J        int
+		Altitude    float64
+		Time        string
+		Measurement map[string]*float64
+		Components  []string
+		Samples     []struct {
+			Attempt    int
+			Valid      bool
+			Best       bool
+			Residual   *float64
+			Iterations int
+			Converged  bool
+			N          []float64 `json:"n"`
+			GF         []float64 `json:"GF"`
+			Delta      []float64 `json:"delta"`
+			Mre        []float64 `json:"mre"`
+		}
+	}
+	if err := json.Unmarshal(writeTestDump(t, "json"), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.I != 1 || got.J != 2 || got.Altitude != 1500 || got.Time != "12:10" {
+		t.Errorf("point (%d, %d) at %v, %q, want (1, 2) at 1500, \"12:10\"", got.I, got.J, got.Altitude, got.Time)
+	}
+	if strings.Join(got.Components, " ") != "d s" {
+		t.Errorf("components = %v, want [d s]", got.Components)
+	}
+	// Деполяризация записывается не штрихованной: delta = delta'/(1-delta')
+	if delta := got.Measurement["delta"]; delta == nil || math.Abs(*delta-0.1/0.9) > 1e-12 {
+		t.Errorf("measurement delta = %v, want %g", delta, 0.1/0.9)
+	}
+	if got.Measurement["delta_err"] != nil || got.Measurement["gf_err"] == nil || *got.Measurement["gf_err"] != 1e-5 {
+		t.Errorf("measurement errors = %v, want null delta_err and gf_err 1e-5", got.Measurement)
+	}
+
+	if len(got.Samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(got.Samples))
+	}
+	first, second := got.Samples[0], got.Samples[1]
+	if first.Attempt != 1 || !first.Valid || !first.Best || !first.Converged || first.Iterations != 35 ||
+		first.Residual == nil || *first.Residual != 0.02 {
+		t.Errorf("first sample = %+v", first)
+	}
+	if first.N[0] != 0.3 || first.GF[1] != 5e-4 || math.Abs(first.Delta[0]-0.25) > 1e-12 || first.Mre[1] != 1.52 {
+		t.Errorf("first sample values n %v, GF %v, delta %v, mre %v", first.N, first.GF, first.Delta, first.Mre)
+	}
+	if second.Valid || second.Best || second.Residual != nil || second.Iterations != 200 {
+		t.Errorf("second sample = %+v, want invalid with null residual", second)
+	}
+}
+
+func TestSampleDumpWriterCSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(string(writeTestDump(t, "csv")))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantHeader := "attempt,valid,best,residual,iterations,converged,n_d,n_s,GF_d,GF_s,delta_d,delta_s,mre_d,mre_s"
+	if len(records) != 3 || strings.Join(records[0], ",") != wantHeader {
+		t.Fatalf("got %d rows with header %v, want 3 rows with header %s", len(records), records[0], wantHeader)
+	}
+	wantRows := []string{
+		"1,true,true,0.02,35,true,0.3,0.7,5e-05,0.0005,0.25,1,1.42,1.52",
+		"2,false,false,NaN,200,false,0.6,0.4,5e-05,0.0005,0.25,1,1.42,1.52",
+	}
+	for k, want := range wantRows {
+		if got := strings.Join(records[k+1], ","); got != want {
+			t.Errorf("row %d = %s, want %s", k+1, got, want)
+		}
+	}
+}
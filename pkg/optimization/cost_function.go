@@ -9,6 +9,8 @@ import (
 
 type CostFunction struct {
 	logger *zap.Logger
+	// trace — журнал диагностики точки (nil — диагностика отключена)
+	trace  *zap.Logger
 	data   *domain.PointData
 	params *domain.Parameters
 	conf   *domain.Config
@@ -34,6 +36,10 @@ func calcPenaltyForNegativeValues(x []float64) float64 {
 	return penalty
 }
 
+// sumTolerance — допустимое отклонение суммы долей от 1, в пределах которого
+// calcSmoothPenalty не штрафует сумму
+const sumTolerance = 0.01
+
 func calcSmoothPenalty(x []float64) float64 {
 	var penalty float64
 	eq := 0.0
@@ -41,7 +47,7 @@ func calcSmoothPenalty(x []float64) float64 {
 		eq += val
 	}
 	eq -= 1.0
-	if math.Abs(eq) > 0.01 {
+	if math.Abs(eq) > sumTolerance {
 		penalty += 1e4 * math.Pow(eq, 2)
 	}
 	return penalty
@@ -50,7 +56,12 @@ func calcSmoothPenalty(x []float64) float64 {
 // calculateResidual вычисляет основную невязку без штрафов за ограничения.
 // Возвращает: невязка (если критичные условия не выполнены).
 func (c *CostFunction) calculateResidual(x []float64) float64 {
+	eps, _ := c.weightedResiduals(x)
+	return lossValue(c.conf.GetLossFunction(), eps[:], c.conf.LossScale)
+}
 
+// weightedResiduals вычисляет взвешенные невязки уравнений и их веса
+func (c *CostFunction) weightedResiduals(x []float64) (eps, weights [4]float64) {
 	eqs := c.calculateEquations(x)
 
 	// Уравнения (остатки)
@@ -65,75 +76,46 @@ func (c *CostFunction) calculateResidual(x []float64) float64 {
 		eq4 = 0
 	}
 
-	// Адаптивные веса
-	weight1 := 1.0
-	weight2 := 1.0 / math.Max(1e-8, math.Abs(c.data.DeltaPrime))
-	weight3 := 1.0 / math.Max(1e-8, math.Abs(c.data.Gf))
-	weight4 := 1.0 / math.Max(1e-8, math.Abs(c.data.M))
+	// Веса: 1/sigma (хи-квадрат), если погрешность измерения задана,
+	// иначе относительная невязка 1/|значение|
+	weights = [4]float64{
+		1.0,
+		measurementWeight(c.data.DeltaPrime, c.data.DeltaPrimeErr),
+		measurementWeight(c.data.Gf, c.data.GfErr),
+		measurementWeight(c.data.M, c.data.MErr),
+	}
 
 	// Нормированные остатки
-	eps1 := weight1 * eq1
-	eps2 := weight2 * eq2
-	eps3 := weight3 * eq3
-	eps4 := weight4 * eq4
-
-	residual := math.Sqrt(eps1*eps1 + eps2*eps2 + eps3*eps3 + eps4*eps4)
+	eps = [4]float64{
+		weights[0] * eq1,
+		weights[1] * eq2,
+		weights[2] * eq3,
+		weights[3] * eq4,
+	}
+	return eps, weights
+}
 
-	return residual
+// measurementWeight возвращает вес невязки измеренной величины value с погрешностью sigma.
+// Если погрешность не задана (NaN или не положительна), используется 1/|value|.
+func measurementWeight(value, sigma float64) float64 {
+	if sigma > 0 {
+		return 1.0 / sigma
+	}
+	return 1.0 / math.Max(1e-8, math.Abs(value))
 }
 
 // calculateEquations вычисляет значения параметров смеси
-func (c *CostFunction) calculateEquations(x []float64) []float64 {
-
-	result := CalculateEquations(x, &c.conf.LR, &c.conf.CV, c.params)
-
-	// nd, nu, ns, nw := x[0], x[1], x[2], x[3]
-
-	// // Вычисление объёмов
-	// vd := nd * c.conf.LR.D * c.conf.CV.D
-	// vu := nu * c.conf.LR.U * c.conf.CV.U
-	// vs := ns * c.conf.LR.S * c.conf.CV.S
-	// vw := nw * c.conf.LR.W * c.conf.CV.W
-	// vTotal := vd + vu + vs + vw
-
-	// // Уравнения (остатки)
-	// eq1 := nd + nu + ns + nw
-	// eq2 := c.deltaPrimeD*nd + c.deltaPrimeU*nu +
-	// 	c.deltaPrimeS*ns + c.deltaPrimeW*nw
-	// eq3 := c.params.GfD*nd + c.params.GfU*nu +
-	// 	c.params.GfS*ns + c.params.GfW*nw
-
-	// var eq4 float64
-	// if vTotal > 1e-8 {
-	// 	mCalc := (c.params.MreD*vd + c.params.MreU*vu +
-	// 		c.params.MreS*vs + c.params.MreW*vw) / vTotal
-	// 	eq4 = mCalc
-	// } else {
-	// 	eq4 = 0
-	// }
-
-	return result
+func (c *CostFunction) calculateEquations(x []float64) [4]float64 {
+	return mixtureEquations(x, c.conf.Components, c.params)
 }
 
 // Value — основная функция стоимости. Проверяет ограничения и добавляет штрафы.
 func (c *CostFunction) Value(x []float64) float64 {
 	// Проверка размерности
-	if len(x) != 4 {
+	if len(x) != len(c.conf.Components) {
 		return 1e10
 	}
 
-	nd, nu, ns, nw := x[0], x[1], x[2], x[3]
-
-	c.logger.Info("Input",
-		zap.Float64("nd", nd),
-		zap.Float64("nu", nu),
-		zap.Float64("ns", ns),
-		zap.Float64("nw", nw),
-		zap.Float64("mrD", c.params.MreD),
-		zap.Float64("mrU", c.params.MreU),
-		zap.Float64("mrS", c.params.MreS),
-		zap.Float64("mrW", c.params.MreW))
-
 	// Плавное наказание за отрицательность
 	penalty := calcPenaltyForNegativeValues(x)
 
@@ -146,11 +128,15 @@ func (c *CostFunction) Value(x []float64) float64 {
 	// Итоговый результат
 	total := residual + penalty + smoothPenalty
 
-	c.logger.Debug("Residuals",
-		zap.Float64("residual", residual),
-		zap.Float64("penalty", penalty),
-		zap.Float64("smPenalty", smoothPenalty),
-		zap.Float64("total", total))
+	if c.trace != nil {
+		c.trace.Info("Cost",
+			zap.Float64s("fractions", x),
+			zap.Any("parameters", *c.params),
+			zap.Float64("residual", residual),
+			zap.Float64("penalty", penalty),
+			zap.Float64("smPenalty", smoothPenalty),
+			zap.Float64("total", total))
+	}
 
 	// if penalty > 0 {
 	// 	return penalty
@@ -159,73 +145,156 @@ func (c *CostFunction) Value(x []float64) float64 {
 	return total
 }
 
-// Gradient вычисляет градиент функции в точке x и сохраняет результат в gradient
+// Gradient вычисляет аналитический градиент функции стоимости (невязка и штрафы).
+// Если в конфигурации включен gradient_check, градиент сравнивается
+// с конечно-разностным, и расхождения записываются в лог.
 func (c *CostFunction) Gradient(x []float64) []float64 {
-	n := len(x)
-	gradient := make([]float64, n)
-	h := 1e-3 // Лучше для численной устойчивости
+	gradient := c.residualGradient(x)
 
-	fx := c.Value(x)
+	// Штраф за отрицательность: 1000·x²
+	for k, val := range x {
+		if val < 0 {
+			gradient[k] += 2000 * val
+		}
+	}
 
-	// Временный срез для модификаций (не трогаем входной x)
-	xMod := make([]float64, n)
-	copy(xMod, x)
+	// Штраф за отклонение суммы долей больше чем на sumTolerance: 1e4·(Σx - 1)²
+	eq := -1.0
+	for _, val := range x {
+		eq += val
+	}
+	if math.Abs(eq) > sumTolerance {
+		for k := range gradient {
+			gradient[k] += 2e4 * eq
+		}
+	}
 
-	for i := 0; i < n; i++ {
-		// Увеличиваем i-ю координату
-		xMod[i] += h
-		fxh := c.Value(xMod)
+	if c.conf.GradientCheck {
+		c.checkGradient(x, gradient, c.Value)
+	}
 
-		// Вычисляем разностную производную
-		if math.IsInf(fx, 0) || math.IsInf(fxh, 0) || math.IsNaN(fxh-fx) {
-			gradient[i] = 0 // Или другое безопасное значение
-		} else {
-			gradient[i] = (fxh - fx) / h
-		}
+	if c.trace != nil {
+		c.trace.Info("Gradient",
+			zap.Float64s("input", x),
+			zap.Float64s("gradient", gradient))
+	}
 
-		// Восстанавливаем исходное значение
-		xMod[i] = x[i]
+	return gradient
+}
+
+// residualGradient вычисляет аналитический градиент невязки без штрафов:
+// ∂R/∂x_k = Σ_i ∂L/∂eps_i · w_i · ∂eq_i/∂x_k
+func (c *CostFunction) residualGradient(x []float64) []float64 {
+	eps, weights := c.weightedResiduals(x)
+	dLoss := lossGradient(c.conf.GetLossFunction(), eps[:], c.conf.LossScale)
+
+	// Коэффициент преломления смеси M = Σ m_k v_k x_k / Σ v_k x_k,
+	// ∂M/∂x_k = v_k (m_k - M) / Σ v_i x_i
+	var vTotal, mSum float64
+	for k, comp := range c.conf.Components {
+		v := x[k] * comp.LR * comp.CV
+		vTotal += v
+		mSum += (*c.params)[k].Mre * v
+	}
+	mixM := 0.0
+	if vTotal > 1e-8 {
+		mixM = mSum / vTotal
 	}
 
-	c.logger.Debug("Gradient computed",
-		zap.Float64s("input", x),
-		zap.Float64("base_value", fx),
-		zap.Float64s("gradient", gradient))
+	gradient := make([]float64, len(x))
+	for k, comp := range c.conf.Components {
+		p := (*c.params)[k]
+		g := dLoss[0]*weights[0] +
+			dLoss[1]*weights[1]*p.DeltaPrime +
+			dLoss[2]*weights[2]*p.Gf
+		if mixM > 0 {
+			g += dLoss[3] * weights[3] * comp.LR * comp.CV * (p.Mre - mixM) / vTotal
+		}
+		gradient[k] = g
+	}
 
+	if c.conf.GradientCheck {
+		c.checkGradient(x, gradient, c.calculateResidual)
+	}
 	return gradient
 }
 
-// calculateEquations вычисляет значения параметров смеси
-func CalculateEquations(x []float64, lrCoefs *domain.LRCoeffs, cvCoefs *domain.CVCoeffs, p *domain.Parameters) []float64 {
-	nd, nu, ns, nw := x[0], x[1], x[2], x[3]
+// gradientCheckTolerance — допустимое относительное расхождение аналитического
+// и конечно-разностного градиентов в режиме gradient_check. В точках излома
+// (доля, равная нулю; нулевая невязка при l1; граница допуска суммы долей)
+// разностная производная неточна, и предупреждения там ожидаемы.
+const gradientCheckTolerance = 1e-3
+
+// checkGradient сравнивает градиент с вычисленным центральными разностями
+// для функции f и записывает в лог предупреждение при расхождении
+func (c *CostFunction) checkGradient(x, gradient []float64, f func([]float64) float64) {
+	numeric := numericGradient(f, x)
+	maxErr := 0.0
+	for k := range gradient {
+		err := math.Abs(gradient[k]-numeric[k]) / math.Max(1, math.Abs(numeric[k]))
+		maxErr = math.Max(maxErr, err)
+	}
+	if maxErr > gradientCheckTolerance {
+		c.logger.Warn("Analytic gradient differs from finite differences",
+			zap.Int("i", c.data.I),
+			zap.Int("j", c.data.J),
+			zap.Float64s("x", x),
+			zap.Float64s("analytic", gradient),
+			zap.Float64s("numeric", numeric),
+			zap.Float64("max_rel_error", maxErr))
+	}
+}
+
+// numericGradient вычисляет градиент функции f в точке x центральными разностями
+func numericGradient(f func([]float64) float64, x []float64) []float64 {
+	gradient := make([]float64, len(x))
+	h := 1e-6
 
-	// Вычисление объёмов
-	vd := nd * lrCoefs.D * cvCoefs.D
-	vu := nu * lrCoefs.U * cvCoefs.U
-	vs := ns * lrCoefs.S * cvCoefs.S
-	vw := nw * lrCoefs.W * cvCoefs.W
-	vTotal := vd + vu + vs + vw
+	// Временный срез для модификаций (не трогаем входной x)
+	xMod := make([]float64, len(x))
+	copy(xMod, x)
+	for i := range x {
+		xMod[i] = x[i] + h
+		fxh := f(xMod)
+		xMod[i] = x[i] - h
+		fxl := f(xMod)
+		if !math.IsNaN(fxh-fxl) && !math.IsInf(fxh-fxl, 0) {
+			gradient[i] = (fxh - fxl) / (2 * h)
+		}
+		xMod[i] = x[i]
+	}
+	return gradient
+}
 
-	deltaPrimeD := p.DeltaDPrime
-	deltaPrimeU := p.DeltaUPrime
-	deltaPrimeS := p.DeltaSPrime
-	deltaPrimeW := p.DeltaWPrime
+// CalculateEquations вычисляет левые части уравнений смеси: сумму долей,
+// деполяризацию, емкость флуоресценции и коэффициент преломления смеси
+func CalculateEquations(x []float64, components []domain.Component, p *domain.Parameters) []float64 {
+	eqs := mixtureEquations(x, components, p)
+	return eqs[:]
+}
 
-	// Уравнения (остатки)
-	eq1 := nd + nu + ns + nw
-	eq2 := deltaPrimeD*nd + deltaPrimeU*nu +
-		deltaPrimeS*ns + deltaPrimeW*nw
-	eq3 := p.GfD*nd + p.GfU*nu +
-		p.GfS*ns + p.GfW*nw
+// mixtureEquations — вариант CalculateEquations без выделения памяти для
+// вычисления функции стоимости
+func mixtureEquations(x []float64, components []domain.Component, p *domain.Parameters) [4]float64 {
+	var eq1, eq2, eq3, vTotal, mSum float64
+	for k, comp := range components {
+		n := x[k]
+		// Вычисление объёмов
+		v := n * comp.LR * comp.CV
+		vTotal += v
+		mSum += (*p)[k].Mre * v
+
+		eq1 += n
+		eq2 += (*p)[k].DeltaPrime * n
+		eq3 += (*p)[k].Gf * n
+	}
 
 	var eq4 float64
 	if vTotal > 1e-8 {
-		mCalc := (p.MreD*vd + p.MreU*vu +
-			p.MreS*vs + p.MreW*vw) / vTotal
-		eq4 = mCalc
+		eq4 = mSum / vTotal
 	} else {
 		eq4 = 0
 	}
 
-	return []float64{eq1, eq2, eq3, eq4}
+	return [4]float64{eq1, eq2, eq3, eq4}
 }
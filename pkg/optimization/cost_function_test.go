@@ -0,0 +1,130 @@
+package optimization
+
+import (
+	"math"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"lidar-classification/internal/domain"
+)
+
+// testConfig возвращает конфигурацию с четырьмя компонентами из config.yaml
+func testConfig() *domain.Config {
+	uniform := func(min, max float64) domain.Prior {
+		return domain.Prior{Dist: domain.DistUniform, Min: min, Max: max}
+	}
+	return &domain.Config{
+		Components: []domain.Component{
+			{Name: "d", LR: 49, CV: 0.07, GfRange: uniform(1e-5, 1e-4), MRange: uniform(1.40, 1.45), DeltaRange: uniform(0.20, 0.35)},
+			{Name: "u", LR: 46, CV: 0.08, GfRange: uniform(1e-5, 1e-4), MRange: uniform(1.53, 1.55), DeltaRange: uniform(0.05, 0.15)},
+			{Name: "s", LR: 65, CV: 0.085, GfRange: uniform(2e-4, 1e-3), MRange: uniform(1.51, 1.54), DeltaRange: uniform(0.01, 0.10)},
+			{Name: "w", LR: 33, CV: 0.12, GfRange: uniform(1e-9, 1e-5), MRange: uniform(1.33, 1.35), DeltaRange: uniform(0.001, 0.01)},
+		},
+		NSamples:         20,
+		N1:               5,
+		Epsilon:          0.1,
+		Seed:             1,
+		Method:           "nelder-mead",
+		Parameterization: "direct",
+		CostFunction:     "l2",
+		LossScale:        1,
+	}
+}
+
+// testPoint — точка со смесью пыли и дыма
+var testPoint = domain.PointData{DeltaPrime: 0.12, Gf: 2.5e-4, M: 1.47}
+
+// gradientTestParams — параметры типов для проверки градиента
+var gradientTestParams = domain.Parameters{
+	{Gf: 5e-5, DeltaPrime: 0.2, Mre: 1.42},
+	{Gf: 5e-5, DeltaPrime: 0.09, Mre: 1.54},
+	{Gf: 5e-4, DeltaPrime: 0.05, Mre: 1.52},
+	{Gf: 1e-6, DeltaPrime: 0.005, Mre: 1.34},
+}
+
+// TestCostFunctionGradient сравнивает аналитический градиент с центральными
+// разностями вдали от изломов: доли не равны нулю, |Σx - 1| не близко к
+// допуску 0.01, невязки не равны нулю (для l1)
+func TestCostFunctionGradient(t *testing.T) {
+	points := []struct {
+		name string
+		x    []float64
+	}{
+		{name: "sum within tolerance", x: []float64{0.4, 0.1, 0.3, 0.195}},
+		{name: "sum above tolerance", x: []float64{0.5, 0.2, 0.3, 0.2}},
+		{name: "sum below tolerance", x: []float64{0.2, 0.1, 0.3, 0.1}},
+		{name: "negative fractions", x: []float64{0.7, -0.05, 0.4, -0.1}},
+		{name: "dominant component", x: []float64{0.9, 0.04, 0.03, 0.025}},
+	}
+	measurements := []struct {
+		name string
+		data domain.PointData
+	}{
+		{name: "relative", data: domain.PointData{DeltaPrime: 0.12, Gf: 2.5e-4, M: 1.47,
+			DeltaPrimeErr: math.NaN(), GfErr: math.NaN(), MErr: math.NaN()}},
+		{name: "uncertainties", data: domain.PointData{DeltaPrime: 0.12, Gf: 2.5e-4, M: 1.47,
+			DeltaPrimeErr: 0.01, GfErr: 3e-5, MErr: 0.02}},
+	}
+
+	config := testConfig()
+	for _, loss := range []string{"l2", "l1", "huber", "cauchy", "chi2"} {
+		config.CostFunction = loss
+		for _, m := range measurements {
+			data := m.data
+			params := gradientTestParams
+			cost := NewCostFunction(zap.NewNop(), &data, &params, config)
+
+			for _, p := range points {
+				analytic := cost.Gradient(p.x)
+				numeric := numericGradient(cost.Value, p.x)
+				for k := range p.x {
+					if math.Abs(analytic[k]-numeric[k]) > 1e-5*math.Max(1, math.Abs(numeric[k])) {
+						t.Errorf("%s/%s/%s: gradient %v, finite differences %v",
+							loss, m.name, p.name, analytic, numeric)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestCostFunctionGradientCheck проверяет, что режим gradient_check молчит
+// при верном градиенте и сообщает о расхождении
+func TestCostFunctionGradientCheck(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	config := testConfig()
+	config.GradientCheck = true
+	data := testPoint
+	params := gradientTestParams
+	cost := NewCostFunction(zap.New(core), &data, &params, config)
+
+	x := []float64{0.4, 0.1, 0.3, 0.195}
+	gradient := cost.Gradient(x)
+	if n := logs.Len(); n != 0 {
+		t.Fatalf("correct gradient: got %d warnings, want none", n)
+	}
+
+	gradient[0] *= 1.1
+	cost.checkGradient(x, gradient, cost.Value)
+	if n := logs.FilterMessage("Analytic gradient differs from finite differences").Len(); n != 1 {
+		t.Errorf("wrong gradient: got %d warnings, want 1", n)
+	}
+}
+
+// TestSumToleranceMatchesLBFGSBand проверяет, что слой суммы долей метода
+// lbfgs лежит внутри допуска штрафа, а за допуском штраф положителен
+func TestSumToleranceMatchesLBFGSBand(t *testing.T) {
+	for _, sum := range []float64{1 - lbfgsSumTolerance, 1 + lbfgsSumTolerance} {
+		if penalty := calcSmoothPenalty([]float64{sum / 2, sum / 2}); penalty != 0 {
+			t.Errorf("sum %g: penalty = %g, want 0", sum, penalty)
+		}
+	}
+	for _, sum := range []float64{1 - 1.01*sumTolerance, 1 + 1.01*sumTolerance} {
+		if penalty := calcSmoothPenalty([]float64{sum / 2, sum / 2}); penalty <= 0 {
+			t.Errorf("sum %g: penalty = %g, want positive", sum, penalty)
+		}
+	}
+}
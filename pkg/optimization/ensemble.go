@@ -0,0 +1,96 @@
+package optimization
+
+import (
+	"lidar-classification/internal/domain"
+	"math"
+	"sort"
+)
+
+// ensembleSpread заполняет в avg стандартные отклонения долей и параметров
+// по ансамблю samples и, если withPercentiles, процентили уровней domain.PercentileLevels.
+func ensembleSpread(avg *domain.Solution, samples []*domain.Solution, withPercentiles bool) {
+	fractions := make([][]float64, len(samples))
+	params := make([][]float64, len(samples))
+	for k, sample := range samples {
+		fractions[k] = sample.Fractions
+		params[k] = sample.Parameters.Array()
+	}
+	spreadFromRows(avg, fractions, params, withPercentiles)
+}
+
+// spreadFromRows заполняет разброс по выборкам, заданным строками долей и
+// параметров (в порядке domain.Parameters.Array)
+func spreadFromRows(avg *domain.Solution, fractions, params [][]float64, withPercentiles bool) {
+	avg.FractionsStd = domain.Fractions(columnStd(fractions, avg.Fractions))
+	avg.ParametersStd = domain.ParametersFromArray(columnStd(params, avg.Parameters.Array()))
+
+	if !withPercentiles {
+		return
+	}
+
+	avg.Percentiles = make([]domain.Percentile, len(domain.PercentileLevels))
+	fracPct := columnPercentiles(fractions, domain.PercentileLevels)
+	paramPct := columnPercentiles(params, domain.PercentileLevels)
+	for k, level := range domain.PercentileLevels {
+		avg.Percentiles[k] = domain.Percentile{
+			Level:      level,
+			Fractions:  domain.Fractions(fracPct[k]),
+			Parameters: domain.ParametersFromArray(paramPct[k]),
+		}
+	}
+}
+
+// columnStd вычисляет выборочное стандартное отклонение каждого столбца rows
+// относительно заданных средних. Для одной выборки разброс равен нулю.
+func columnStd(rows [][]float64, mean []float64) []float64 {
+	std := make([]float64, len(mean))
+	if len(rows) < 2 {
+		return std
+	}
+
+	for _, row := range rows {
+		for i, value := range row {
+			d := value - mean[i]
+			std[i] += d * d
+		}
+	}
+	for i := range std {
+		std[i] = math.Sqrt(std[i] / float64(len(rows)-1))
+	}
+	return std
+}
+
+// columnPercentiles вычисляет процентили каждого столбца rows.
+// Результат индексируется как [уровень][столбец].
+func columnPercentiles(rows [][]float64, levels []float64) [][]float64 {
+	n := len(rows[0])
+	result := make([][]float64, len(levels))
+	for k := range result {
+		result[k] = make([]float64, n)
+	}
+
+	column := make([]float64, len(rows))
+	for i := range n {
+		for k, row := range rows {
+			column[k] = row[i]
+		}
+		sort.Float64s(column)
+		for k, level := range levels {
+			result[k][i] = percentile(column, level)
+		}
+	}
+	return result
+}
+
+// percentile возвращает процентиль p (0..100) отсортированного среза
+// с линейной интерполяцией между порядковыми статистиками.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := min(lo+1, len(sorted)-1)
+	frac := pos - float64(lo)
+	return sorted[lo] + frac*(sorted[hi]-sorted[lo])
+}
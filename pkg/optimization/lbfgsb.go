@@ -0,0 +1,332 @@
+package optimization
+
+import (
+	"math"
+	"slices"
+
+	"github.com/physicist2018/optimization-go/optimization"
+)
+
+// LBFGSBConfig — конфигурация квазиньютоновского метода L-BFGS-B
+type LBFGSBConfig struct {
+	MaxIterations int
+	// Tolerance — порог для нормы проекции градиента и относительного
+	// изменения функции между итерациями
+	Tolerance float64
+	// Memory — число сохраняемых пар (s, y) для приближения обратного гессиана
+	Memory int
+	// Lower, Upper — границы, одинаковые для всех переменных
+	Lower, Upper float64
+	// SumLower, SumUpper — границы суммы переменных (±Inf — сумма не ограничена)
+	SumLower, SumUpper float64
+	// MaxLineSearch — максимальное число дроблений шага при поиске вдоль направления
+	MaxLineSearch int
+}
+
+// DefaultLBFGSBConfig возвращает конфигурацию по умолчанию с границами [0, 1]
+func DefaultLBFGSBConfig() LBFGSBConfig {
+	return LBFGSBConfig{
+		MaxIterations: 200,
+		Tolerance:     1e-6,
+		Memory:        5,
+		Lower:         0,
+		Upper:         1,
+		SumLower:      math.Inf(-1),
+		SumUpper:      math.Inf(1),
+		MaxLineSearch: 30,
+	}
+}
+
+// LBFGSB — метод L-BFGS с ограничениями-границами (проективный вариант).
+// Переменные на границе, градиент в которых направлен наружу, фиксируются,
+// направление по остальным строится двухпетлевой рекурсией L-BFGS,
+// шаг проецируется на допустимую область: параллелепипед [Lower, Upper],
+// пересеченный со слоем SumLower <= Σx <= SumUpper. Все итерации остаются
+// внутри области, поэтому штрафы за выход из нее не нужны.
+// Реализует интерфейс optimization.Optimizer.
+type LBFGSB struct {
+	config LBFGSBConfig
+}
+
+// NewLBFGSB создает оптимизатор L-BFGS-B
+func NewLBFGSB(config LBFGSBConfig) *LBFGSB {
+	return &LBFGSB{config: config}
+}
+
+// Optimize минимизирует f, начиная с initial (проецируется на границы).
+// Если f не реализует optimization.GradientFunction, градиент вычисляется
+// центральными разностями.
+func (o *LBFGSB) Optimize(f optimization.TargetFunction, initial []float64) optimization.OptimizerResult {
+	n := len(initial)
+	gradient := func(x []float64) []float64 {
+		if gf, ok := f.(optimization.GradientFunction); ok {
+			return gf.Gradient(x)
+		}
+		return o.numericGradient(f, x)
+	}
+
+	x := make([]float64, n)
+	copy(x, initial)
+	o.project(x)
+	fx := f.Value(x)
+	g := gradient(x)
+
+	var sHist, yHist [][]float64
+	xNew := make([]float64, n)
+	free := make([]bool, n)
+
+	for iter := 0; iter < o.config.MaxIterations; iter++ {
+		if o.projectedGradientNorm(x, g) <= o.config.Tolerance {
+			return o.result(x, fx, iter, true, "Converged")
+		}
+
+		// Переменные на границе с градиентом наружу исключаются из шага
+		for i := range x {
+			free[i] = !(x[i] <= o.config.Lower && g[i] > 0) && !(x[i] >= o.config.Upper && g[i] < 0)
+		}
+
+		d := twoLoopDirection(g, free, sHist, yHist)
+		if len(sHist) == 0 || dot(g, d) >= 0 {
+			// Без памяти или при неубывающем направлении идем по антиградиенту.
+			// Проекция сама удерживает переменные на границах, а шаг по полному
+			// антиградиенту остается убывающим и после сдвига на грань слоя суммы.
+			sHist, yHist = nil, nil
+			for i := range d {
+				d[i] = -g[i]
+			}
+		}
+		if len(sHist) == 0 {
+			// Без информации о кривизне ограничиваем первый шаг единицей по
+			// max-норме свободных переменных
+			norm := 0.0
+			for i := range d {
+				if free[i] {
+					norm = math.Max(norm, math.Abs(d[i]))
+				}
+			}
+			if norm > 1 {
+				for i := range d {
+					d[i] /= norm
+				}
+			}
+		}
+
+		// Поиск шага с проекцией (условие Армихо по фактическому смещению)
+		step := 1.0
+		fNew := math.Inf(1)
+		accepted := false
+		for range o.config.MaxLineSearch {
+			for i := range x {
+				xNew[i] = x[i] + step*d[i]
+			}
+			o.project(xNew)
+
+			decrease := 0.0
+			for i := range x {
+				decrease += g[i] * (xNew[i] - x[i])
+			}
+			fNew = f.Value(xNew)
+			if decrease < 0 && fNew <= fx+1e-4*decrease {
+				accepted = true
+				break
+			}
+			step *= 0.5
+		}
+		if !accepted {
+			if len(sHist) > 0 {
+				// После проекции на грани направление L-BFGS может не давать
+				// убывания; повторяем итерацию по антиградиенту
+				sHist, yHist = nil, nil
+				continue
+			}
+			return o.result(x, fx, iter+1, false, "Line search failed")
+		}
+
+		gNew := gradient(xNew)
+		s := make([]float64, n)
+		y := make([]float64, n)
+		for i := range x {
+			s[i] = xNew[i] - x[i]
+			y[i] = gNew[i] - g[i]
+		}
+		// Пара сохраняется только при положительной кривизне
+		if dot(s, y) > 1e-12 {
+			sHist = append(sHist, s)
+			yHist = append(yHist, y)
+			if len(sHist) > o.config.Memory {
+				sHist, yHist = sHist[1:], yHist[1:]
+			}
+		}
+
+		converged := math.Abs(fx-fNew) <= o.config.Tolerance*math.Max(1, math.Max(math.Abs(fx), math.Abs(fNew)))
+		copy(x, xNew)
+		fx, g = fNew, gNew
+		if converged {
+			return o.result(x, fx, iter+1, true, "Converged")
+		}
+	}
+
+	return o.result(x, fx, o.config.MaxIterations, false, "Max iterations reached")
+}
+
+func (o *LBFGSB) result(x []float64, value float64, iterations int, converged bool, message string) optimization.OptimizerResult {
+	return optimization.OptimizerResult{
+		X:          x,
+		Value:      value,
+		Iterations: iterations,
+		Converged:  converged,
+		Message:    message,
+	}
+}
+
+// project проецирует x на допустимую область. Если после проекции на
+// параллелепипед сумма выходит из слоя, проекция на пересечение
+// параллелепипеда с ближайшей гранью слоя имеет вид clip(x_i - τ).
+// Сумма clip(x_i - τ) кусочно-линейна и не возрастает по τ с изломами
+// в точках x_i - Upper и x_i - Lower, поэтому τ находится линейной
+// интерполяцией между соседними изломами.
+func (o *LBFGSB) project(x []float64) {
+	clip := func(v float64) float64 {
+		return math.Min(o.config.Upper, math.Max(o.config.Lower, v))
+	}
+	shifted := func(tau float64) float64 {
+		sum := 0.0
+		for _, v := range x {
+			sum += clip(v - tau)
+		}
+		return sum
+	}
+
+	sum := shifted(0)
+	target := math.Min(math.Max(sum, o.config.SumLower), o.config.SumUpper)
+	tau := 0.0
+	if target != sum {
+		breaks := make([]float64, 0, 2*len(x))
+		for _, v := range x {
+			breaks = append(breaks, v-o.config.Upper, v-o.config.Lower)
+		}
+		slices.Sort(breaks)
+
+		// Если target вне [n·Lower, n·Upper], берется ближайшая вершина
+		tau = breaks[len(breaks)-1]
+		prev, prevSum := breaks[0], shifted(breaks[0])
+		if prevSum <= target {
+			tau = prev
+		} else {
+			for _, b := range breaks[1:] {
+				if bSum := shifted(b); bSum <= target {
+					tau = prev + (prevSum-target)/(prevSum-bSum)*(b-prev)
+					break
+				} else {
+					prev, prevSum = b, bSum
+				}
+			}
+		}
+	}
+	for i, v := range x {
+		x[i] = clip(v - tau)
+	}
+}
+
+// projectedGradientNorm возвращает max-норму проекции градиента: |P(x - g) - x|
+func (o *LBFGSB) projectedGradientNorm(x, g []float64) float64 {
+	p := make([]float64, len(x))
+	for i := range x {
+		p[i] = x[i] - g[i]
+	}
+	o.project(p)
+
+	norm := 0.0
+	for i := range x {
+		norm = math.Max(norm, math.Abs(p[i]-x[i]))
+	}
+	return norm
+}
+
+// numericGradient вычисляет градиент центральными разностями, не выходя за границы
+func (o *LBFGSB) numericGradient(f optimization.TargetFunction, x []float64) []float64 {
+	const h = 1e-6
+	g := make([]float64, len(x))
+	xMod := make([]float64, len(x))
+	copy(xMod, x)
+	for i := range x {
+		hi := math.Min(x[i]+h, o.config.Upper)
+		lo := math.Max(x[i]-h, o.config.Lower)
+		xMod[i] = hi
+		fHi := f.Value(xMod)
+		xMod[i] = lo
+		fLo := f.Value(xMod)
+		xMod[i] = x[i]
+		if hi > lo {
+			g[i] = (fHi - fLo) / (hi - lo)
+		}
+	}
+	return g
+}
+
+// twoLoopDirection вычисляет направление -H·g двухпетлевой рекурсией L-BFGS
+// в подпространстве свободных переменных (для остальных направление нулевое)
+func twoLoopDirection(g []float64, free []bool, sHist, yHist [][]float64) []float64 {
+	masked := func(v []float64) []float64 {
+		r := make([]float64, len(v))
+		for i := range v {
+			if free[i] {
+				r[i] = v[i]
+			}
+		}
+		return r
+	}
+
+	q := masked(g)
+	m := len(sHist)
+	alpha := make([]float64, m)
+	rho := make([]float64, m)
+	s := make([][]float64, m)
+	y := make([][]float64, m)
+	for k := m - 1; k >= 0; k-- {
+		s[k], y[k] = masked(sHist[k]), masked(yHist[k])
+		sy := dot(s[k], y[k])
+		if sy <= 1e-12 {
+			continue
+		}
+		rho[k] = 1 / sy
+		alpha[k] = rho[k] * dot(s[k], q)
+		for i := range q {
+			q[i] -= alpha[k] * y[k][i]
+		}
+	}
+
+	// Начальное приближение гессиана по последней паре
+	gamma := 1.0
+	if m > 0 && rho[m-1] > 0 {
+		if yy := dot(y[m-1], y[m-1]); yy > 0 {
+			gamma = 1 / (rho[m-1] * yy)
+		}
+	}
+	for i := range q {
+		q[i] *= gamma
+	}
+
+	for k := 0; k < m; k++ {
+		if rho[k] == 0 {
+			continue
+		}
+		beta := rho[k] * dot(y[k], q)
+		for i := range q {
+			q[i] += s[k][i] * (alpha[k] - beta)
+		}
+	}
+
+	for i := range q {
+		q[i] = -q[i]
+	}
+	return q
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,209 @@
+package optimization
+
+import (
+	"math"
+	"testing"
+)
+
+// quadratic — f(x) = Σ w_i (x_i - c_i)² с аналитическим градиентом
+type quadratic struct {
+	w, c []float64
+}
+
+func (q quadratic) Value(x []float64) float64 {
+	sum := 0.0
+	for i := range x {
+		sum += q.w[i] * (x[i] - q.c[i]) * (x[i] - q.c[i])
+	}
+	return sum
+}
+
+func (q quadratic) Gradient(x []float64) []float64 {
+	g := make([]float64, len(x))
+	for i := range x {
+		g[i] = 2 * q.w[i] * (x[i] - q.c[i])
+	}
+	return g
+}
+
+// valueOnly скрывает градиент функции, чтобы оптимизатор использовал разности
+type valueOnly struct {
+	f interface{ Value([]float64) float64 }
+}
+
+func (v valueOnly) Value(x []float64) float64 { return v.f.Value(x) }
+
+// rosenbrock — f(x, y) = (1 - x)² + 100 (y - x²)², минимум в (1, 1)
+type rosenbrock struct{}
+
+func (rosenbrock) Value(x []float64) float64 {
+	return (1-x[0])*(1-x[0]) + 100*(x[1]-x[0]*x[0])*(x[1]-x[0]*x[0])
+}
+
+func (rosenbrock) Gradient(x []float64) []float64 {
+	return []float64{
+		-2*(1-x[0]) - 400*x[0]*(x[1]-x[0]*x[0]),
+		200 * (x[1] - x[0]*x[0]),
+	}
+}
+
+func TestLBFGSBMinimizesWithinBounds(t *testing.T) {
+	boxed := DefaultLBFGSBConfig()
+	wide := DefaultLBFGSBConfig()
+	wide.Lower, wide.Upper = -2, 2
+	slab := DefaultLBFGSBConfig()
+	slab.SumLower, slab.SumUpper = 0.99, 1.01
+
+	tests := []struct {
+		name    string
+		config  LBFGSBConfig
+		f       interface{ Value([]float64) float64 }
+		initial []float64
+		want    []float64
+	}{
+		{
+			name:    "interior minimum",
+			config:  boxed,
+			f:       quadratic{w: []float64{1, 10, 100}, c: []float64{0.3, 0.7, 0.5}},
+			initial: []float64{0.9, 0.1, 0},
+			want:    []float64{0.3, 0.7, 0.5},
+		},
+		{
+			// Функция разделима, поэтому минимум — проекция c на отрезок [0, 1]
+			name:    "minimum outside box",
+			config:  boxed,
+			f:       quadratic{w: []float64{1, 5, 2}, c: []float64{-0.5, 1.5, 0.4}},
+			initial: []float64{0.5, 0.5, 0.5},
+			want:    []float64{0, 1, 0.4},
+		},
+		{
+			name:    "infeasible initial point",
+			config:  boxed,
+			f:       quadratic{w: []float64{1, 1}, c: []float64{0.2, 0.8}},
+			initial: []float64{-3, 7},
+			want:    []float64{0.2, 0.8},
+		},
+		{
+			name:    "rosenbrock",
+			config:  wide,
+			f:       rosenbrock{},
+			initial: []float64{-1.2, 1},
+			want:    []float64{1, 1},
+		},
+		{
+			// При равных весах минимум — проекция c на грань Σx = 1.01
+			name:    "sum constraint",
+			config:  slab,
+			f:       quadratic{w: []float64{1, 1, 1}, c: []float64{0.6, 0.6, 0.6}},
+			initial: []float64{1, 0, 0},
+			want:    []float64{1.01 / 3, 1.01 / 3, 1.01 / 3},
+		},
+		{
+			// Проекция c на параллелепипед (1, 0, 0.1) дает сумму 1.1;
+			// на грани Σx = 1.01 первая и вторая доли остаются на границах
+			name:    "sum and bound constraints",
+			config:  slab,
+			f:       quadratic{w: []float64{1, 1, 1}, c: []float64{1.2, -0.4, 0.1}},
+			initial: []float64{0.3, 0.3, 0.3},
+			want:    []float64{1, 0, 0.01},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, f := range []interface{ Value([]float64) float64 }{tt.f, valueOnly{tt.f}} {
+				result := NewLBFGSB(tt.config).Optimize(f, tt.initial)
+				if !result.Converged {
+					t.Errorf("%T: not converged: %s", f, result.Message)
+				}
+				for i := range tt.want {
+					if math.Abs(result.X[i]-tt.want[i]) > 1e-4 {
+						t.Errorf("%T: x = %v, want %v", f, result.X, tt.want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestLBFGSBSumConstraintLowerEdge проверяет, что сумма остается в слое и
+// при минимуме внутри параллелепипеда, но вне слоя снизу
+func TestLBFGSBSumConstraintLowerEdge(t *testing.T) {
+	config := DefaultLBFGSBConfig()
+	config.SumLower, config.SumUpper = 0.99, 1.01
+	f := quadratic{w: []float64{1, 3, 9, 27}, c: []float64{0.1, 0.2, 0.05, 0.3}}
+
+	result := NewLBFGSB(config).Optimize(f, []float64{0.25, 0.25, 0.25, 0.25})
+	sum := 0.0
+	for _, v := range result.X {
+		if v < 0 || v > 1 {
+			t.Fatalf("x = %v is outside [0, 1]", result.X)
+		}
+		sum += v
+	}
+	if math.Abs(sum-0.99) > 1e-9 {
+		t.Errorf("sum = %.12f, want 0.99 (lower edge of the constraint)", sum)
+	}
+
+	// На грани Σx = s минимум взвешенной квадратичной функции: x_i = c_i + λ/w_i
+	lambda := (0.99 - 0.65) / (1 + 1.0/3 + 1.0/9 + 1.0/27)
+	for i := range f.c {
+		if want := f.c[i] + lambda/f.w[i]; math.Abs(result.X[i]-want) > 1e-3 {
+			t.Errorf("x = %v, want x[%d] = %g", result.X, i, want)
+		}
+	}
+}
+
+func TestLBFGSBProject(t *testing.T) {
+	tests := []struct {
+		name               string
+		sumLower, sumUpper float64
+		x, want            []float64
+	}{
+		{name: "box only", sumLower: math.Inf(-1), sumUpper: math.Inf(1), x: []float64{1.5, -0.5, 0.3}, want: []float64{1, 0, 0.3}},
+		{name: "uniform shift", sumLower: 1, sumUpper: 1, x: []float64{0.5, 0.5, 0.5}, want: []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		{name: "shift with clipping", sumLower: 1, sumUpper: 1, x: []float64{0.9, 0.6, 0.1}, want: []float64{0.65, 0.35, 0}},
+		{name: "clipped components", sumLower: 1, sumUpper: 1, x: []float64{2, -1, 0.5}, want: []float64{1, 0, 0}},
+		{name: "raise to lower edge", sumLower: 0.99, sumUpper: 1.01, x: []float64{0.1, 0.2, 0}, want: []float64{0.33, 0.43, 0.23}},
+		{name: "inside slab", sumLower: 0.99, sumUpper: 1.01, x: []float64{0.2, 0.3, 0.5}, want: []float64{0.2, 0.3, 0.5}},
+		{name: "infeasible sum", sumLower: 5, sumUpper: 5, x: []float64{0.2, 0.3, 0.5}, want: []float64{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultLBFGSBConfig()
+			config.SumLower, config.SumUpper = tt.sumLower, tt.sumUpper
+			o := NewLBFGSB(config)
+
+			x := append([]float64(nil), tt.x...)
+			o.project(x)
+			for i := range tt.want {
+				if math.Abs(x[i]-tt.want[i]) > 1e-12 {
+					t.Fatalf("project(%v) = %v, want %v", tt.x, x, tt.want)
+				}
+			}
+
+			// Проекция идемпотентна
+			y := append([]float64(nil), x...)
+			o.project(y)
+			for i := range x {
+				if math.Abs(x[i]-y[i]) > 1e-12 {
+					t.Fatalf("project is not idempotent: %v -> %v", x, y)
+				}
+			}
+		})
+	}
+}
+
+func TestLBFGSBMaxIterations(t *testing.T) {
+	config := DefaultLBFGSBConfig()
+	config.Lower, config.Upper = -2, 2
+	config.MaxIterations = 3
+
+	result := NewLBFGSB(config).Optimize(rosenbrock{}, []float64{-1.2, 1})
+	if result.Converged || result.Iterations != 3 || result.Message != "Max iterations reached" {
+		t.Errorf("got converged=%v iterations=%d message=%q, want max iterations stop",
+			result.Converged, result.Iterations, result.Message)
+	}
+}
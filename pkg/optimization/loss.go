@@ -0,0 +1,100 @@
+package optimization
+
+import (
+	"lidar-classification/internal/domain"
+	"math"
+)
+
+// lossValue применяет функцию потерь к вектору взвешенных невязок eps.
+// scale — масштаб перехода от квадратичного к линейному (Huber) или
+// логарифмическому (Cauchy) росту; при scale <= 0 используется 1.
+func lossValue(loss domain.LossFunction, eps []float64, scale float64) float64 {
+	if scale <= 0 {
+		scale = 1
+	}
+
+	var sum float64
+	switch loss {
+	case domain.LossL1:
+		for _, e := range eps {
+			sum += math.Abs(e)
+		}
+		return sum
+
+	case domain.LossHuber:
+		for _, e := range eps {
+			a := math.Abs(e)
+			if a <= scale {
+				sum += 0.5 * e * e
+			} else {
+				sum += scale * (a - 0.5*scale)
+			}
+		}
+		return sum
+
+	case domain.LossCauchy:
+		for _, e := range eps {
+			r := e / scale
+			sum += 0.5 * scale * scale * math.Log1p(r*r)
+		}
+		return sum
+
+	case domain.LossChiSquare:
+		for _, e := range eps {
+			sum += e * e
+		}
+		return sum
+
+	default:
+		for _, e := range eps {
+			sum += e * e
+		}
+		return math.Sqrt(sum)
+	}
+}
+
+// lossGradient возвращает производные функции потерь по взвешенным невязкам eps.
+// В точках излома (L1 при e = 0, L2 при нулевых невязках) производная равна 0.
+func lossGradient(loss domain.LossFunction, eps []float64, scale float64) []float64 {
+	if scale <= 0 {
+		scale = 1
+	}
+
+	grad := make([]float64, len(eps))
+	switch loss {
+	case domain.LossL1:
+		for i, e := range eps {
+			switch {
+			case e > 0:
+				grad[i] = 1
+			case e < 0:
+				grad[i] = -1
+			}
+		}
+
+	case domain.LossHuber:
+		for i, e := range eps {
+			grad[i] = math.Max(-scale, math.Min(scale, e))
+		}
+
+	case domain.LossCauchy:
+		for i, e := range eps {
+			r := e / scale
+			grad[i] = e / (1 + r*r)
+		}
+
+	case domain.LossChiSquare:
+		for i, e := range eps {
+			grad[i] = 2 * e
+		}
+
+	default:
+		norm := lossValue(domain.LossL2, eps, scale)
+		if norm > 0 {
+			for i, e := range eps {
+				grad[i] = e / norm
+			}
+		}
+	}
+	return grad
+}
@@ -0,0 +1,268 @@
+package optimization
+
+import (
+	"lidar-classification/internal/domain"
+	"math"
+)
+
+const (
+	// sumWeight — вес уравнения суммы долей; большой вес приближает решение
+	// к симплексу (сумма долей равна 1) без явного ограничения-равенства
+	sumWeight = 1e3
+	// lsqMaxReweight — максимальное число уточнений линеаризации уравнения
+	// коэффициента преломления
+	lsqMaxReweight = 10
+	lsqTolerance   = 1e-10
+)
+
+// SolveLinearized находит доли компонент как решение задачи наименьших
+// квадратов с ограничением неотрицательности (алгоритм Лоусона-Хэнсона).
+// Уравнения суммы долей, деполяризации и емкости флуоресценции линейны по
+// долям. Уравнение коэффициента преломления Σ m_k v_k n_k / Σ v_k n_k = M
+// приводится к линейному Σ (m_k - M) v_k n_k / V = 0, где V = Σ v_k n_k
+// берется с предыдущей итерации. Веса уравнений те же, что в CostFunction.
+func SolveLinearized(data *domain.PointData, params *domain.Parameters, components []domain.Component) []float64 {
+	n := len(components)
+	weight2 := measurementWeight(data.DeltaPrime, data.DeltaPrimeErr)
+	weight3 := measurementWeight(data.Gf, data.GfErr)
+	weight4 := measurementWeight(data.M, data.MErr)
+
+	a := make([][]float64, 4)
+	for r := range a {
+		a[r] = make([]float64, n)
+	}
+	b := []float64{sumWeight, weight2 * data.DeltaPrime, weight3 * data.Gf, 0}
+	for k := range components {
+		a[0][k] = sumWeight
+		a[1][k] = weight2 * (*params)[k].DeltaPrime
+		a[2][k] = weight3 * (*params)[k].Gf
+	}
+
+	// Начальное приближение - равные доли
+	x := make([]float64, n)
+	for k := range x {
+		x[k] = 1.0 / float64(n)
+	}
+
+	for range lsqMaxReweight {
+		vTotal := 0.0
+		for k, comp := range components {
+			vTotal += x[k] * comp.LR * comp.CV
+		}
+		if vTotal <= 1e-8 {
+			vTotal = 1e-8
+		}
+		for k, comp := range components {
+			a[3][k] = weight4 * ((*params)[k].Mre - data.M) * comp.LR * comp.CV / vTotal
+		}
+
+		next := nnls(a, b)
+		change := 0.0
+		for k := range x {
+			change = math.Max(change, math.Abs(next[k]-x[k]))
+		}
+		x = next
+		if change <= 1e-8 {
+			break
+		}
+	}
+	return x
+}
+
+// nnls решает задачу min ||A·x - b|| при x >= 0 методом Лоусона-Хэнсона.
+// Столбцы пассивного множества всегда линейно независимы: кандидат, который
+// линейно зависит от уже выбранных столбцов или получает неположительное
+// значение, отклоняется до следующей внешней итерации. Поэтому число
+// ненулевых долей не превышает ранга A, и при числе компонент больше числа
+// уравнений решение подзадачи остается единственным.
+func nnls(a [][]float64, b []float64) []float64 {
+	m, n := len(a), len(a[0])
+	x := make([]float64, n)
+	passive := make([]bool, n)
+	rejected := make([]bool, n)
+
+	// gradient вычисляет w = Aᵀ(b - A·x)
+	gradient := func() []float64 {
+		res := make([]float64, m)
+		for i := range a {
+			res[i] = b[i]
+			for j := range x {
+				res[i] -= a[i][j] * x[j]
+			}
+		}
+		w := make([]float64, n)
+		for j := range w {
+			for i := range a {
+				w[j] += a[i][j] * res[i]
+			}
+		}
+		return w
+	}
+
+	tolerance := lsqTolerance * columnScale(a)
+	for range 3 * n {
+		w := gradient()
+		clear(rejected)
+
+		// Выбор переменной с наибольшей производной, для которой подзадача
+		// невырождена и дает положительное значение
+		var z []float64
+		for {
+			best, bestW := -1, tolerance
+			for j := range w {
+				if !passive[j] && !rejected[j] && w[j] > bestW {
+					best, bestW = j, w[j]
+				}
+			}
+			if best < 0 {
+				return x
+			}
+			passive[best] = true
+			var ok bool
+			if z, ok = passiveLeastSquares(a, b, passive); ok && z[best] > 0 {
+				break
+			}
+			passive[best] = false
+			rejected[best] = true
+		}
+
+		for {
+			// Если решение допустимо, принимаем его
+			alpha := 1.0
+			limit := -1
+			for j := range z {
+				if !passive[j] || z[j] > 0 {
+					continue
+				}
+				// x[j] = z[j] = 0: переменная уже на границе, шаг не ограничивает
+				if d := x[j] - z[j]; d > 0 {
+					if step := x[j] / d; limit < 0 || step < alpha {
+						alpha, limit = step, j
+					}
+				}
+			}
+			if limit < 0 {
+				copy(x, z)
+				break
+			}
+
+			// Иначе смещаемся к z до границы и исключаем обнулившиеся переменные
+			for j := range x {
+				if passive[j] {
+					x[j] += alpha * (z[j] - x[j])
+					if j == limit || x[j] <= lsqTolerance {
+						x[j] = 0
+						passive[j] = false
+					}
+				}
+			}
+
+			// Подмножество независимых столбцов остается независимым
+			var ok bool
+			if z, ok = passiveLeastSquares(a, b, passive); !ok {
+				break
+			}
+		}
+	}
+	return x
+}
+
+// passiveLeastSquares решает задачу наименьших квадратов по столбцам A,
+// отмеченным в passive, QR-разложением Хаусхолдера. Остальные компоненты
+// решения равны нулю. Возвращает false, если выбранные столбцы линейно
+// зависимы (в том числе если их больше, чем строк A) и решение не единственно.
+func passiveLeastSquares(a [][]float64, b []float64, passive []bool) ([]float64, bool) {
+	m, n := len(a), len(a[0])
+	cols := make([]int, 0, n)
+	for j := range passive {
+		if passive[j] {
+			cols = append(cols, j)
+		}
+	}
+	p := len(cols)
+	if p > m {
+		return nil, false
+	}
+
+	// Копия подматрицы и правой части
+	q := make([][]float64, m)
+	for i := range q {
+		q[i] = make([]float64, p)
+		for c, j := range cols {
+			q[i][c] = a[i][j]
+		}
+	}
+	rhs := make([]float64, m)
+	copy(rhs, b)
+
+	for c := 0; c < p; c++ {
+		// Норма исходного столбца — масштаб для проверки линейной зависимости
+		colNorm := 0.0
+		for i := range m {
+			colNorm += a[i][cols[c]] * a[i][cols[c]]
+		}
+		norm := 0.0
+		for i := c; i < m; i++ {
+			norm += q[i][c] * q[i][c]
+		}
+		norm = math.Sqrt(norm)
+		if norm <= lsqTolerance*math.Sqrt(colNorm) {
+			return nil, false
+		}
+		if q[c][c] > 0 {
+			norm = -norm
+		}
+		// Вектор отражения v = x - norm·e1 хранится в столбце c
+		q[c][c] -= norm
+		vv := 0.0
+		for i := c; i < m; i++ {
+			vv += q[i][c] * q[i][c]
+		}
+		for k := c + 1; k < p; k++ {
+			s := 0.0
+			for i := c; i < m; i++ {
+				s += q[i][c] * q[i][k]
+			}
+			s *= 2 / vv
+			for i := c; i < m; i++ {
+				q[i][k] -= s * q[i][c]
+			}
+		}
+		s := 0.0
+		for i := c; i < m; i++ {
+			s += q[i][c] * rhs[i]
+		}
+		s *= 2 / vv
+		for i := c; i < m; i++ {
+			rhs[i] -= s * q[i][c]
+		}
+		q[c][c] = norm
+	}
+
+	// Обратная подстановка
+	z := make([]float64, p)
+	for c := p - 1; c >= 0; c-- {
+		s := rhs[c]
+		for k := c + 1; k < p; k++ {
+			s -= q[c][k] * z[k]
+		}
+		z[c] = s / q[c][c]
+	}
+
+	x := make([]float64, n)
+	for c, j := range cols {
+		x[j] = z[c]
+	}
+	return x, true
+}
+
+// columnScale возвращает наибольший по модулю элемент матрицы (масштаб для допусков)
+func columnScale(a [][]float64) float64 {
+	scale := 0.0
+	for _, row := range a {
+		for _, v := range row {
+			scale = math.Max(scale, math.Abs(v))
+		}
+	}
+	return math.Max(scale, 1)
+}
@@ -0,0 +1,259 @@
+package optimization
+
+import (
+	"math"
+	"testing"
+
+	"lidar-classification/internal/domain"
+)
+
+// checkNNLSOptimality проверяет условия Куна-Таккера для min ||A·x - b||, x >= 0:
+// x >= 0, w = Aᵀ(b - A·x) <= 0, и w = 0 для положительных x
+func checkNNLSOptimality(t *testing.T, a [][]float64, b, x []float64) {
+	t.Helper()
+	const tol = 1e-7
+	scale := columnScale(a) * math.Max(1, maxAbs(b))
+	for j := range x {
+		if math.IsNaN(x[j]) || x[j] < 0 {
+			t.Fatalf("x[%d] = %g, want finite non-negative", j, x[j])
+		}
+		w := 0.0
+		for i := range a {
+			r := b[i]
+			for k := range x {
+				r -= a[i][k] * x[k]
+			}
+			w += a[i][j] * r
+		}
+		if w > tol*scale {
+			t.Errorf("w[%d] = %g > 0: solution %v is not optimal", j, w, x)
+		}
+		if x[j] > 0 && math.Abs(w) > tol*scale {
+			t.Errorf("w[%d] = %g for positive x[%d] = %g", j, w, j, x[j])
+		}
+	}
+}
+
+func maxAbs(a []float64) float64 {
+	var m float64
+	for _, v := range a {
+		m = math.Max(m, math.Abs(v))
+	}
+	return m
+}
+
+func TestNNLSKnownSolutions(t *testing.T) {
+	tests := []struct {
+		name string
+		a    [][]float64
+		b    []float64
+		want []float64
+	}{
+		{
+			name: "unconstrained solution is feasible",
+			a:    [][]float64{{2, 0}, {0, 4}},
+			b:    []float64{2, 2},
+			want: []float64{1, 0.5},
+		},
+		{
+			name: "negative component clipped",
+			a:    [][]float64{{1, 0}, {0, 1}},
+			b:    []float64{1, -1},
+			want: []float64{1, 0},
+		},
+		{
+			name: "overdetermined",
+			a:    [][]float64{{1, 0}, {1, 0}, {0, 1}},
+			b:    []float64{2, 1, 1},
+			want: []float64{1.5, 1},
+		},
+		{
+			name: "all components zero",
+			a:    [][]float64{{1, 2}, {3, 4}},
+			b:    []float64{-1, -1},
+			want: []float64{0, 0},
+		},
+		{
+			// Без ограничения решение (2, -1); с ограничением — проекция b на первый столбец
+			name: "active constraint changes other component",
+			a:    [][]float64{{1, 1}, {0, 1}, {1, 0}},
+			b:    []float64{1, -1, 2},
+			want: []float64{1.5, 0},
+		},
+		{
+			// Пятый столбец уменьшает первые две координаты и только ухудшает невязку
+			name: "five components, four equations",
+			a: [][]float64{
+				{1, 0, 0, 0, -1},
+				{0, 1, 0, 0, -1},
+				{0, 0, 1, 0, 0},
+				{0, 0, 0, 1, 0},
+			},
+			b:    []float64{1, 2, -1, 0},
+			want: []float64{1, 2, 0, 0, 0},
+		},
+		{
+			// Третий столбец — сумма первых двух: решение не единственно,
+			// проверяется только оптимальность
+			name: "duplicate direction",
+			a:    [][]float64{{1, 0, 1}, {0, 1, 1}},
+			b:    []float64{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := nnls(tt.a, tt.b)
+			checkNNLSOptimality(t, tt.a, tt.b, x)
+			for j := range tt.want {
+				if math.Abs(x[j]-tt.want[j]) > 1e-9 {
+					t.Errorf("x = %v, want %v", x, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+// TestNNLSMoreComponentsThanEquations проверяет, что при числе столбцов больше
+// числа строк и вырожденных столбцах решение не содержит NaN и оптимально
+func TestNNLSMoreComponentsThanEquations(t *testing.T) {
+	tests := []struct {
+		name string
+		a    [][]float64
+		b    []float64
+	}{
+		{
+			name: "six components",
+			a: [][]float64{
+				{1e3, 1e3, 1e3, 1e3, 1e3, 1e3},
+				{1.8, 0.6, 0.3, 0.02, 1.1, 0.9},
+				{0.4, 0.4, 4, 0.02, 2, 0.1},
+				{-0.05, 0.07, 0.05, -0.12, 0.01, -0.02},
+			},
+			b: []float64{1e3, 0.7, 1.5, 0},
+		},
+		{
+			name: "zero and repeated columns",
+			a: [][]float64{
+				{1, 0, 1, 1, 0.5},
+				{0, 0, 1, 1, 0.5},
+				{1, 0, 0, 0, 0.5},
+				{0, 0, 2, 2, 1},
+			},
+			b: []float64{3, 2, 1, 4},
+		},
+		{
+			name: "linearly dependent positive columns",
+			a: [][]float64{
+				{1, 2, 3, 1, 2},
+				{1, 1, 1, 2, 2},
+				{0, 1, 2, -1, 0},
+			},
+			b: []float64{4, 3, 1},
+		},
+		{
+			// Третий столбец почти лежит в плоскости первых двух, но большая
+			// невязка третьего уравнения делает его производную положительной
+			name: "nearly dependent column",
+			a:    [][]float64{{10, 0, 1}, {0, 10, 1}, {0, 0, 1e-12}},
+			b:    []float64{10, 10, 1e4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkNNLSOptimality(t, tt.a, tt.b, nnls(tt.a, tt.b))
+		})
+	}
+}
+
+func TestPassiveLeastSquaresRank(t *testing.T) {
+	a := [][]float64{
+		{1, 2, 0, 1},
+		{0, 4, 1, 1},
+	}
+	b := []float64{3, 4}
+
+	z, ok := passiveLeastSquares(a, b, []bool{true, false, true, false})
+	if !ok || math.Abs(z[0]-3) > 1e-12 || math.Abs(z[2]-4) > 1e-12 || z[1] != 0 || z[3] != 0 {
+		t.Errorf("independent columns: got %v, %v, want [3 0 4 0], true", z, ok)
+	}
+	if _, ok := passiveLeastSquares(a, b, []bool{true, true, true, false}); ok {
+		t.Error("more columns than rows: want rank deficiency")
+	}
+	a[1][3] = 0
+	if _, ok := passiveLeastSquares(a, b, []bool{true, false, false, true}); ok {
+		t.Error("repeated column: want rank deficiency")
+	}
+}
+
+// linearizedCase строит измерения точки по известным долям
+func linearizedCase(fractions []float64, components []domain.Component, params domain.Parameters) domain.PointData {
+	eqs := mixtureEquations(fractions, components, &params)
+	return domain.PointData{
+		DeltaPrime:    eqs[1],
+		Gf:            eqs[2],
+		M:             eqs[3],
+		DeltaPrimeErr: math.NaN(),
+		GfErr:         math.NaN(),
+		MErr:          math.NaN(),
+	}
+}
+
+func TestSolveLinearizedRecoversFractions(t *testing.T) {
+	components := testConfig().Components[:3]
+	params := domain.Parameters{
+		{Gf: 5e-5, DeltaPrime: 0.25, Mre: 1.42},
+		{Gf: 5e-5, DeltaPrime: 0.1, Mre: 1.54},
+		{Gf: 6e-4, DeltaPrime: 0.05, Mre: 1.52},
+	}
+	want := []float64{0.5, 0.3, 0.2}
+	data := linearizedCase(want, components, params)
+
+	x := SolveLinearized(&data, &params, components)
+	for k := range want {
+		if math.Abs(x[k]-want[k]) > 1e-6 {
+			t.Fatalf("fractions = %v, want %v", x, want)
+		}
+	}
+}
+
+func TestSolveLinearizedManyComponents(t *testing.T) {
+	base := testConfig().Components
+	params := domain.Parameters{
+		{Gf: 5e-5, DeltaPrime: 0.25, Mre: 1.42},
+		{Gf: 5e-5, DeltaPrime: 0.1, Mre: 1.54},
+		{Gf: 6e-4, DeltaPrime: 0.05, Mre: 1.52},
+		{Gf: 1e-6, DeltaPrime: 0.005, Mre: 1.34},
+		{Gf: 3e-4, DeltaPrime: 0.15, Mre: 1.50},
+		{Gf: 5e-5, DeltaPrime: 0.25, Mre: 1.42},
+	}
+	components := append(base[:4:4],
+		domain.Component{Name: "m", LR: 55, CV: 0.09},
+		domain.Component{Name: "d2", LR: 49, CV: 0.07})
+
+	for _, n := range []int{5, 6} {
+		fractions := []float64{0.3, 0.1, 0.2, 0.1, 0.3, 0}[:n]
+		p := params[:n]
+		data := linearizedCase(fractions, components[:n], p)
+
+		x := SolveLinearized(&data, &p, components[:n])
+		sum := 0.0
+		for k, v := range x {
+			if math.IsNaN(v) || v < 0 {
+				t.Fatalf("n=%d: fraction %d = %g", n, k, v)
+			}
+			sum += v
+		}
+		// Решение не единственно, но должно воспроизводить измерения
+		eqs := mixtureEquations(x, components[:n], &p)
+		if math.Abs(sum-1) > 1e-4 ||
+			math.Abs(eqs[1]-data.DeltaPrime) > 1e-4*data.DeltaPrime ||
+			math.Abs(eqs[2]-data.Gf) > 1e-4*data.Gf ||
+			math.Abs(eqs[3]-data.M) > 1e-4 {
+			t.Errorf("n=%d: fractions %v give %v, want (1, %g, %g, %g)",
+				n, x, eqs, data.DeltaPrime, data.Gf, data.M)
+		}
+	}
+}
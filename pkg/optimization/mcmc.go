@@ -0,0 +1,528 @@
+package optimization
+
+import (
+	"lidar-classification/internal/domain"
+	"math"
+	"math/cmplx"
+	"math/rand/v2"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// stretchScale — параметр a растягивающего хода Гудмана-Вэра (z ∈ [1/a, a])
+const stretchScale = 2.0
+
+// initDraws — число выборок априорного распределения на точку ансамбля при инициализации
+const initDraws = 100
+
+// deMoveProbability — доля ходов дифференциальной эволюции (ter Braak 2006)
+// среди ходов точек ансамбля, остальные — растягивающие ходы. Растягивающий
+// ход медленно перемешивает цепи при 15 и более переменных.
+const deMoveProbability = 0.8
+
+// deJumpProbability — доля ходов дифференциальной эволюции с множителем 1,
+// которые переносят точку ансамбля между модами распределения
+const deJumpProbability = 0.1
+
+// resetWindows — число окон прогрева; в конце каждого окна, кроме последнего,
+// отстающие точки ансамбля переносятся к остальным
+const resetWindows = 4
+
+// MCMCSampler оценивает апостериорное распределение долей и параметров компонент
+// в точке аффинно-инвариантным ансамблевым сэмплером (Goodman, Weare 2010).
+// Переменные сэмплера — логиты координат единичного гиперкуба: первые n-1
+// координат задают доли через stick-breaking с плоским распределением Дирихле,
+// остальные отображаются в параметры через обратные функции их априорных
+// распределений. Равномерная плотность в гиперкубе соответствует априорному
+// распределению. Логит-преобразование убирает границы гиперкуба: апостериорное
+// распределение часто прижато к границе априорного диапазона, и у границы
+// почти все предложения растягивающего хода выходили бы из гиперкуба.
+// Если после steps шагов статистика Гельмана-Рубина больше max_rhat, число
+// шагов удваивается (не больше max_steps), а первая половина выборок
+// отбрасывается как продолжение прогрева.
+type MCMCSampler struct {
+	logger *zap.Logger
+}
+
+func NewMCMCSampler(logger *zap.Logger) *MCMCSampler {
+	return &MCMCSampler{logger: logger}
+}
+
+// Solve возвращает апостериорные средние, разброс и процентили (достоверные
+// интервалы) долей и параметров, а также диагностику сходимости цепей
+func (s *MCMCSampler) Solve(data *domain.PointData, config *domain.Config) *domain.Solution {
+	rng := newPointRand(config.Seed, data.I, data.J)
+	n := len(config.Components)
+	dim := config.MCMC.Dim(n)
+	nWalkers := config.MCMC.Walkers
+	target := newPosterior(s.logger, data, config)
+
+	// Начальные точки ансамбля — лучшие по правдоподобию из initDraws выборок
+	// априорного распределения на каждую точку ансамбля. Апостериорное
+	// распределение обычно занимает малую часть гиперкуба, и без этого
+	// прогрев занимает слишком много шагов.
+	candidates := make([][]float64, initDraws*nWalkers)
+	candidateLogp := make([]float64, len(candidates))
+	for k := range candidates {
+		candidates[k] = make([]float64, dim)
+		for d := range candidates[k] {
+			u := rng.Float64()
+			candidates[k][d] = math.Log(u / (1 - u))
+		}
+		candidateLogp[k] = target.logProbability(candidates[k])
+	}
+	order := make([]int, len(candidates))
+	for k := range order {
+		order[k] = k
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return candidateLogp[order[a]] > candidateLogp[order[b]]
+	})
+	walkers := make([][]float64, nWalkers)
+	logp := make([]float64, nWalkers)
+	for w := range walkers {
+		walkers[w], logp[w] = candidates[order[w]], candidateLogp[order[w]]
+	}
+
+	proposal := make([]float64, dim)
+	accepted := 0
+
+	// move выполняет шаг ансамбля: каждая точка предлагает ход дифференциальной
+	// эволюции или растягивающий ход и принимает его по правилу Метрополиса
+	move := func(count bool) {
+		for w := range walkers {
+			other := rng.IntN(nWalkers - 1)
+			if other >= w {
+				other++
+			}
+
+			var logz float64
+			if rng.Float64() < deMoveProbability {
+				// x_w + γ·(x_a - x_b) с двумя другими точками ансамбля; ход симметричен
+				third := rng.IntN(nWalkers - 2)
+				if third >= min(w, other) {
+					third++
+				}
+				if third >= max(w, other) {
+					third++
+				}
+				gamma := 2.38 / math.Sqrt(2*float64(dim))
+				if rng.Float64() < deJumpProbability {
+					gamma = 1
+				}
+				for d := range proposal {
+					proposal[d] = walkers[w][d] + gamma*(walkers[other][d]-walkers[third][d]) + 1e-5*rng.NormFloat64()
+				}
+			} else {
+				z := math.Pow((stretchScale-1)*rng.Float64()+1, 2) / stretchScale
+				for d := range proposal {
+					proposal[d] = walkers[other][d] + z*(walkers[w][d]-walkers[other][d])
+				}
+				logz = float64(dim-1) * math.Log(z)
+			}
+
+			lp := target.logProbability(proposal)
+			if math.Log(rng.Float64()) < logz+lp-logp[w] {
+				copy(walkers[w], proposal)
+				logp[w] = lp
+				if count {
+					accepted++
+				}
+			}
+		}
+	}
+
+	// Прогрев. В конце окна прогрева точки, средний logp которых за окно
+	// выпадает из распределения по ансамблю, переносятся к остальным.
+	burnIn := config.MCMC.BurnIn
+	window := burnIn / resetWindows
+	meanLogp := make([]float64, nWalkers)
+	for step := range burnIn {
+		move(false)
+		if window == 0 {
+			continue
+		}
+		for w := range logp {
+			meanLogp[w] += logp[w] / float64(window)
+		}
+		if (step+1)%window == 0 && (step+1)/window < resetWindows {
+			resetStuckWalkers(rng, walkers, logp, meanLogp)
+			clear(meanLogp)
+		}
+	}
+
+	// Выборки после прогрева: строка s*nWalkers+w содержит доли и параметры
+	// (в порядке domain.Parameters.Array) точки w на шаге s
+	var samples [][]float64
+	sample := func(steps int) {
+		for range steps {
+			move(true)
+			for _, walker := range walkers {
+				fractions, params := target.point(cubePoint(walker))
+				samples = append(samples, append(fractions, params.Array()...))
+			}
+		}
+	}
+
+	steps := config.MCMC.Steps
+	sample(steps)
+	diagnostics := chainDiagnostics(samples, nWalkers, steps)
+	for !(diagnostics.RHat <= config.MCMC.MaxRHat) && 2*steps <= config.MCMC.MaxSteps {
+		sample(steps)
+		samples = samples[len(samples)-steps*nWalkers:]
+		diagnostics = chainDiagnostics(samples, nWalkers, steps)
+		steps *= 2
+	}
+	diagnostics.Acceptance = float64(accepted) / float64(steps*nWalkers)
+	diagnostics.Steps = steps
+	diagnostics.Converged = diagnostics.RHat <= config.MCMC.MaxRHat
+
+	// Апостериорное среднее
+	mean := make([]float64, 4*n)
+	for _, sample := range samples {
+		for q, value := range sample {
+			mean[q] += value
+		}
+	}
+	for q := range mean {
+		mean[q] /= float64(len(samples))
+	}
+
+	sol := &domain.Solution{
+		Fractions:  domain.Fractions(mean[:n]),
+		Parameters: domain.ParametersFromArray(mean[n:]),
+	}
+
+	// Невязка апостериорного среднего вычисляется с настроенной функцией потерь
+	*target.params = sol.Parameters
+	sol.Residual = target.cost.calculateResidual(sol.Fractions)
+	sol.IsValid = !math.IsNaN(sol.Residual) && !math.IsInf(sol.Residual, 0)
+	if !sol.IsValid {
+		return sol
+	}
+	sol.Difference = equationDifferences(data, sol, config.Components)
+
+	fractionRows := make([][]float64, len(samples))
+	paramRows := make([][]float64, len(samples))
+	for k, sample := range samples {
+		fractionRows[k], paramRows[k] = sample[:n], sample[n:]
+	}
+	spreadFromRows(sol, fractionRows, paramRows, config.Percentiles)
+
+	sol.Diagnostics = diagnostics
+
+	if trace := pointTracer(s.logger, data, config); trace != nil {
+		trace.Info("MCMC diagnostics",
+			zap.Any("diagnostics", sol.Diagnostics),
+			zap.Any("solution", sol))
+	}
+	return sol
+}
+
+// resetStuckWalkers переносит точки ансамбля, застрявшие в области малой
+// вероятности, в положения случайно выбранных точек из лучшей половины.
+// Застрявшими считаются точки, средний logp которых за окно прогрева (meanLogp)
+// ниже первого квартиля больше чем на два межквартильных размаха. Такие точки
+// обычно находятся в малой побочной моде, растягивающий ход почти не выводит
+// их к остальным, а они завышают разброс и R-hat. Вызывается только во время прогрева.
+func resetStuckWalkers(rng *rand.Rand, walkers [][]float64, logp, meanLogp []float64) {
+	sorted := append([]float64(nil), meanLogp...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	q1, median, q3 := sorted[n/4], sorted[n/2], sorted[3*n/4]
+	limit := q1 - 2*(q3-q1)
+
+	var good []int
+	for w, lp := range meanLogp {
+		if lp >= median {
+			good = append(good, w)
+		}
+	}
+	for w, lp := range meanLogp {
+		if lp < limit {
+			src := good[rng.IntN(len(good))]
+			copy(walkers[w], walkers[src])
+			logp[w] = logp[src]
+		}
+	}
+}
+
+// cubePoint отображает логиты в точку единичного гиперкуба
+func cubePoint(theta []float64) []float64 {
+	u := make([]float64, len(theta))
+	for d, t := range theta {
+		u[d] = 1 / (1 + math.Exp(-t))
+	}
+	return u
+}
+
+// posterior — логарифм апостериорной плотности в пространстве логитов
+type posterior struct {
+	// cost вычисляет взвешенные невязки; params — параметры, с которыми она работает
+	cost   *CostFunction
+	params *domain.Parameters
+	config *domain.Config
+	// likelihoodCost — функция стоимости с данными, у которых погрешности
+	// заменены на относительные там, где они не заданы
+	likelihoodCost *CostFunction
+}
+
+func newPosterior(logger *zap.Logger, data *domain.PointData, config *domain.Config) *posterior {
+	// Правдоподобию нужны погрешности всех измерений
+	sigmaData := *data
+	relErr := config.MCMC.RelativeError
+	if !(sigmaData.DeltaPrimeErr > 0) {
+		sigmaData.DeltaPrimeErr = relErr * math.Abs(data.DeltaPrime)
+	}
+	if !(sigmaData.GfErr > 0) {
+		sigmaData.GfErr = relErr * math.Abs(data.Gf)
+	}
+	if !(sigmaData.MErr > 0) {
+		sigmaData.MErr = relErr * math.Abs(data.M)
+	}
+
+	params := make(domain.Parameters, len(config.Components))
+	return &posterior{
+		cost:           NewCostFunction(logger, data, &params, config),
+		params:         &params,
+		config:         config,
+		likelihoodCost: NewCostFunction(logger, &sigmaData, &params, config),
+	}
+}
+
+// point отображает точку гиперкуба в доли и параметры компонент
+func (p *posterior) point(u []float64) ([]float64, domain.Parameters) {
+	n := len(p.config.Components)
+
+	// Stick-breaking с v_k ~ Beta(1, n-1-k) дает равномерное распределение на симплексе
+	fractions := make([]float64, n)
+	remaining := 1.0
+	for k := range n - 1 {
+		v := 1 - math.Pow(1-u[k], 1/float64(n-1-k))
+		fractions[k] = remaining * v
+		remaining -= fractions[k]
+	}
+	fractions[n-1] = remaining
+
+	params := make(domain.Parameters, n)
+	for k, comp := range p.config.Components {
+		v := u[n-1+3*k:]
+		delta := comp.DeltaRange.Quantile(v[1])
+		params[k] = domain.ComponentParameters{
+			Gf:         comp.GfRange.Quantile(v[0]),
+			DeltaPrime: delta / (1 + delta),
+			Mre:        comp.MRange.Quantile(v[2]),
+		}
+	}
+	return fractions, params
+}
+
+// logProbability возвращает логарифм апостериорной плотности в точке theta
+// (логиты координат гиперкуба): логарифм правдоподобия плюс якобиан
+// логит-преобразования Σ log u(1-u). Для l2 и chi2 правдоподобие гауссово:
+// -χ²/2, для робастных функций потерь — exp(-потери).
+func (p *posterior) logProbability(theta []float64) float64 {
+	var jacobian float64
+	for _, t := range theta {
+		// log u(1-u) = -|t| - 2·log(1 + e^-|t|)
+		jacobian += -math.Abs(t) - 2*math.Log1p(math.Exp(-math.Abs(t)))
+	}
+
+	fractions, params := p.point(cubePoint(theta))
+	*p.params = params
+	eps, _ := p.likelihoodCost.weightedResiduals(fractions)
+
+	var lp float64
+	switch loss := p.config.GetLossFunction(); loss {
+	case domain.LossL2, domain.LossChiSquare:
+		lp = -0.5 * lossValue(domain.LossChiSquare, eps[:], p.config.LossScale)
+	default:
+		lp = -lossValue(loss, eps[:], p.config.LossScale)
+	}
+	if math.IsNaN(lp) {
+		return math.Inf(-1)
+	}
+	return lp + jacobian
+}
+
+// chainDiagnostics вычисляет по выборкам (см. MCMCSampler.Solve) наибольшую
+// статистику Гельмана-Рубина по половинам цепей и наименьший эффективный
+// размер выборки по всем переменным
+func chainDiagnostics(samples [][]float64, nWalkers, steps int) *domain.SamplerDiagnostics {
+	diag := &domain.SamplerDiagnostics{RHat: math.NaN(), ESS: math.Inf(1)}
+	if len(samples) == 0 {
+		diag.ESS = 0
+		return diag
+	}
+
+	chain := make([][]float64, nWalkers)
+	for w := range chain {
+		chain[w] = make([]float64, steps)
+	}
+	for q := range samples[0] {
+		for s := range steps {
+			for w := range nWalkers {
+				chain[w][s] = samples[s*nWalkers+w][q]
+			}
+		}
+
+		if rhat := splitRHat(chain); !math.IsNaN(rhat) {
+			diag.RHat = math.Max(rhat, nanToZero(diag.RHat))
+		}
+		tau := autocorrelationTime(chain)
+		diag.ESS = math.Min(diag.ESS, float64(nWalkers*steps)/tau)
+	}
+	return diag
+}
+
+func nanToZero(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
+
+// splitRHat вычисляет статистику Гельмана-Рубина, разделяя каждую цепь на две
+// половины. Для постоянной переменной возвращает 1, для слишком коротких цепей — NaN.
+func splitRHat(chains [][]float64) float64 {
+	half := len(chains[0]) / 2
+	if half < 2 {
+		return math.NaN()
+	}
+
+	m := 2 * len(chains)
+	means := make([]float64, 0, m)
+	var within float64
+	for _, chain := range chains {
+		for _, part := range [][]float64{chain[:half], chain[len(chain)-half:]} {
+			mean, variance := meanVariance(part)
+			means = append(means, mean)
+			within += variance
+		}
+	}
+	within /= float64(m)
+
+	_, meansVariance := meanVariance(means)
+	between := float64(half) * meansVariance
+	if within == 0 {
+		if between == 0 {
+			return 1
+		}
+		return math.Inf(1)
+	}
+	pooled := float64(half-1)/float64(half)*within + between/float64(half)
+	return math.Sqrt(pooled / within)
+}
+
+// meanVariance возвращает среднее и несмещенную дисперсию
+func meanVariance(x []float64) (mean, variance float64) {
+	for _, v := range x {
+		mean += v
+	}
+	mean /= float64(len(x))
+	for _, v := range x {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, variance / float64(len(x)-1)
+}
+
+// autocorrelationTime оценивает интегральное время автокорреляции по
+// автокорреляционной функции, усредненной по цепям ансамбля, с окном M —
+// наименьшим, для которого M >= 5τ(M) (Sokal; так же, как в emcee)
+func autocorrelationTime(chains [][]float64) float64 {
+	steps := len(chains[0])
+	acf := make([]float64, steps)
+	count := 0
+	for _, chain := range chains {
+		if rho := autocorrelation(chain); rho != nil {
+			for t, v := range rho {
+				acf[t] += v
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		// Переменная постоянна во всех цепях
+		return 1
+	}
+
+	tau := 1.0
+	for t := 1; t < steps; t++ {
+		tau += 2 * acf[t] / float64(count)
+		if float64(t) >= 5*tau {
+			break
+		}
+	}
+	return math.Max(tau, 1)
+}
+
+// autocorrelation вычисляет нормированную автокорреляционную функцию ряда
+// через быстрое преобразование Фурье. Для постоянного ряда возвращает nil.
+func autocorrelation(x []float64) []float64 {
+	size := 1
+	for size < 2*len(x) {
+		size <<= 1
+	}
+
+	mean, _ := meanVariance(x)
+	buf := make([]complex128, size)
+	for i, v := range x {
+		buf[i] = complex(v-mean, 0)
+	}
+	fft(buf, false)
+	for i, v := range buf {
+		buf[i] = complex(real(v)*real(v)+imag(v)*imag(v), 0)
+	}
+	fft(buf, true)
+
+	c0 := real(buf[0])
+	if c0 <= 0 {
+		return nil
+	}
+	rho := make([]float64, len(x))
+	for t := range rho {
+		rho[t] = real(buf[t]) / c0
+	}
+	return rho
+}
+
+// fft выполняет на месте преобразование Фурье (обратное, если inverse)
+// по алгоритму Кули-Тьюки; длина a должна быть степенью двойки
+func fft(a []complex128, inverse bool) {
+	n := len(a)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			a[i], a[j] = a[j], a[i]
+		}
+	}
+
+	for length := 2; length <= n; length <<= 1 {
+		angle := 2 * math.Pi / float64(length)
+		if inverse {
+			angle = -angle
+		}
+		w := cmplx.Rect(1, angle)
+		for start := 0; start < n; start += length {
+			wk := complex(1, 0)
+			for k := range length / 2 {
+				u := a[start+k]
+				v := a[start+k+length/2] * wk
+				a[start+k] = u + v
+				a[start+k+length/2] = u - v
+				wk *= w
+			}
+		}
+	}
+
+	if inverse {
+		for i := range a {
+			a[i] /= complex(float64(n), 0)
+		}
+	}
+}
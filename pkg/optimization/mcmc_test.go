@@ -0,0 +1,179 @@
+package optimization
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"lidar-classification/internal/domain"
+)
+
+// iidChains возвращает nChains цепей длины steps из независимых нормальных величин
+func iidChains(rng *rand.Rand, nChains, steps int) [][]float64 {
+	chains := make([][]float64, nChains)
+	for c := range chains {
+		chains[c] = make([]float64, steps)
+		for s := range chains[c] {
+			chains[c][s] = rng.NormFloat64()
+		}
+	}
+	return chains
+}
+
+// ar1Chains возвращает цепи процесса AR(1) x_t = phi·x_{t-1} + e_t со
+// стационарным началом; интегральное время автокорреляции равно (1+phi)/(1-phi)
+func ar1Chains(rng *rand.Rand, nChains, steps int, phi float64) [][]float64 {
+	chains := make([][]float64, nChains)
+	for c := range chains {
+		chains[c] = make([]float64, steps)
+		x := rng.NormFloat64() / math.Sqrt(1-phi*phi)
+		for s := range chains[c] {
+			x = phi*x + rng.NormFloat64()
+			chains[c][s] = x
+		}
+	}
+	return chains
+}
+
+func TestSplitRHat(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	if rhat := splitRHat(iidChains(rng, 16, 2000)); math.Abs(rhat-1) > 0.01 {
+		t.Errorf("iid chains: R-hat = %g, want 1", rhat)
+	}
+	if rhat := splitRHat(ar1Chains(rng, 16, 20000, 0.9)); math.Abs(rhat-1) > 0.02 {
+		t.Errorf("long AR(1) chains: R-hat = %g, want 1", rhat)
+	}
+
+	// Цепи со смещенными средними не сошлись
+	shifted := iidChains(rng, 16, 2000)
+	for c := range shifted {
+		for s := range shifted[c] {
+			shifted[c][s] += float64(c % 2)
+		}
+	}
+	if rhat := splitRHat(shifted); rhat < 1.1 {
+		t.Errorf("chains with different means: R-hat = %g, want > 1.1", rhat)
+	}
+
+	// Тренд внутри цепей обнаруживается только по половинам цепей
+	drift := iidChains(rng, 16, 2000)
+	for c := range drift {
+		for s := range drift[c] {
+			drift[c][s] += 4 * float64(s) / 2000
+		}
+	}
+	if rhat := splitRHat(drift); rhat < 1.1 {
+		t.Errorf("drifting chains: R-hat = %g, want > 1.1", rhat)
+	}
+
+	constant := [][]float64{{2, 2, 2, 2}, {2, 2, 2, 2}}
+	if rhat := splitRHat(constant); rhat != 1 {
+		t.Errorf("constant chains: R-hat = %g, want 1", rhat)
+	}
+	if rhat := splitRHat([][]float64{{1, 2, 3}}); !math.IsNaN(rhat) {
+		t.Errorf("short chain: R-hat = %g, want NaN", rhat)
+	}
+}
+
+func TestAutocorrelationTime(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+
+	if tau := autocorrelationTime(iidChains(rng, 32, 2000)); math.Abs(tau-1) > 0.1 {
+		t.Errorf("iid chains: tau = %g, want 1", tau)
+	}
+
+	for _, phi := range []float64{0.5, 0.9} {
+		want := (1 + phi) / (1 - phi)
+		tau := autocorrelationTime(ar1Chains(rng, 32, 20000, phi))
+		if math.Abs(tau-want) > 0.1*want {
+			t.Errorf("AR(1) phi=%g: tau = %g, want %g", phi, tau, want)
+		}
+	}
+
+	if tau := autocorrelationTime([][]float64{{1, 1, 1}, {1, 1, 1}}); tau != 1 {
+		t.Errorf("constant chains: tau = %g, want 1", tau)
+	}
+}
+
+func TestChainDiagnostics(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	const nWalkers, steps = 16, 5000
+
+	// Выборки в порядке MCMCSampler.Solve: строка s*nWalkers+w; первая
+	// переменная — AR(1) с tau = 19, вторая — независимый шум
+	ar := ar1Chains(rng, nWalkers, steps, 0.9)
+	iid := iidChains(rng, nWalkers, steps)
+	samples := make([][]float64, steps*nWalkers)
+	for s := range steps {
+		for w := range nWalkers {
+			samples[s*nWalkers+w] = []float64{ar[w][s], iid[w][s]}
+		}
+	}
+
+	diag := chainDiagnostics(samples, nWalkers, steps)
+	if wantESS := float64(nWalkers*steps) / 19; math.Abs(diag.ESS-wantESS) > 0.15*wantESS {
+		t.Errorf("ESS = %g, want %g (limited by the correlated variable)", diag.ESS, wantESS)
+	}
+	if diag.RHat < 1 || diag.RHat > 1.05 {
+		t.Errorf("R-hat = %g, want about 1", diag.RHat)
+	}
+}
+
+// TestMCMCSamplerSolve проверяет, что апостериорное среднее долей
+// воспроизводит доли, по которым построены измерения, при узких априорных
+// распределениях параметров двух хорошо различимых компонент
+func TestMCMCSamplerSolve(t *testing.T) {
+	uniform := func(min, max float64) domain.Prior {
+		return domain.Prior{Dist: domain.DistUniform, Min: min, Max: max}
+	}
+	config := testConfig()
+	config.Mode = "mcmc"
+	config.Components = []domain.Component{
+		{Name: "d", LR: 49, CV: 0.07, GfRange: uniform(4.9e-5, 5.1e-5), MRange: uniform(1.42, 1.43), DeltaRange: uniform(0.33, 0.34)},
+		{Name: "s", LR: 65, CV: 0.085, GfRange: uniform(5.9e-4, 6.1e-4), MRange: uniform(1.52, 1.53), DeltaRange: uniform(0.05, 0.055)},
+	}
+	config.MCMC = domain.MCMCConfig{
+		Walkers:       32,
+		Steps:         500,
+		BurnIn:        500,
+		MaxSteps:      2000,
+		MaxRHat:       1.1,
+		RelativeError: 0.02,
+	}
+
+	// Параметры в середине априорных диапазонов
+	params := domain.Parameters{
+		{Gf: 5e-5, DeltaPrime: 0.335 / 1.335, Mre: 1.425},
+		{Gf: 6e-4, DeltaPrime: 0.0525 / 1.0525, Mre: 1.525},
+	}
+	want := []float64{0.3, 0.7}
+	data := linearizedCase(want, config.Components, params)
+
+	sol := NewMCMCSampler(zap.NewNop()).Solve(&data, config)
+	if !sol.IsValid {
+		t.Fatalf("solution is not valid: residual %g", sol.Residual)
+	}
+	for k := range want {
+		if math.Abs(sol.Fractions[k]-want[k]) > 0.05 {
+			t.Errorf("posterior mean fractions = %v, want %v", sol.Fractions, want)
+			break
+		}
+	}
+
+	diag := sol.Diagnostics
+	if diag == nil {
+		t.Fatal("diagnostics are not set")
+	}
+	if !(diag.Acceptance > 0 && diag.Acceptance < 1) {
+		t.Errorf("acceptance = %g, want in (0, 1)", diag.Acceptance)
+	}
+	if diag.Steps < config.MCMC.Steps || diag.Steps > config.MCMC.MaxSteps {
+		t.Errorf("steps = %d, want in [%d, %d]", diag.Steps, config.MCMC.Steps, config.MCMC.MaxSteps)
+	}
+	if diag.Converged != (diag.RHat <= config.MCMC.MaxRHat) || !diag.Converged {
+		t.Errorf("converged = %v with R-hat %g, want converged chains", diag.Converged, diag.RHat)
+	}
+}
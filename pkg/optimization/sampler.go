@@ -0,0 +1,227 @@
+package optimization
+
+import (
+	"lidar-classification/internal/domain"
+	"math/rand/v2"
+)
+
+// Sampler генерирует точки единичного гиперкуба [0, 1)^dim, которые затем
+// отображаются в диапазоны микрофизических параметров
+type Sampler interface {
+	Next() []float64
+}
+
+// NewSampler создает генератор выборок заданного типа. n — ожидаемое число
+// выборок (используется латинским гиперкубом), rng — генератор случайных
+// чисел точки, от которого зависят случайные сдвиги последовательностей.
+func NewSampler(kind domain.Sampling, dim, n int, rng *rand.Rand) Sampler {
+	switch kind {
+	case domain.SamplingHalton:
+		return newHaltonSampler(dim, rng)
+	case domain.SamplingSobol:
+		return newSobolSampler(dim, rng)
+	case domain.SamplingLHS:
+		return newLatinHypercubeSampler(dim, n, rng)
+	default:
+		return &randomSampler{dim: dim, rng: rng}
+	}
+}
+
+// randomSampler — независимые равномерные случайные точки
+type randomSampler struct {
+	dim int
+	rng *rand.Rand
+}
+
+func (s *randomSampler) Next() []float64 {
+	u := make([]float64, s.dim)
+	for i := range u {
+		u[i] = s.rng.Float64()
+	}
+	return u
+}
+
+// haltonSampler — последовательность Хальтона (обратные радикальные функции
+// по первым простым основаниям) со случайным циклическим сдвигом
+// (рандомизация Крэнли-Паттерсона), свой для каждой точки измерений
+type haltonSampler struct {
+	bases []int
+	shift []float64
+	index int
+}
+
+func newHaltonSampler(dim int, rng *rand.Rand) *haltonSampler {
+	shift := make([]float64, dim)
+	for i := range shift {
+		shift[i] = rng.Float64()
+	}
+	return &haltonSampler{bases: firstPrimes(dim), shift: shift}
+}
+
+func (s *haltonSampler) Next() []float64 {
+	s.index++
+	u := make([]float64, len(s.bases))
+	for i, base := range s.bases {
+		v := radicalInverse(s.index, base) + s.shift[i]
+		if v >= 1 {
+			v--
+		}
+		u[i] = v
+	}
+	return u
+}
+
+// radicalInverse отражает цифры числа index в системе счисления base относительно запятой
+func radicalInverse(index, base int) float64 {
+	result := 0.0
+	f := 1.0 / float64(base)
+	for i := index; i > 0; i /= base {
+		result += f * float64(i%base)
+		f /= float64(base)
+	}
+	return result
+}
+
+// firstPrimes возвращает первые n простых чисел
+func firstPrimes(n int) []int {
+	primes := make([]int, 0, n)
+	for candidate := 2; len(primes) < n; candidate++ {
+		prime := true
+		for _, p := range primes {
+			if p*p > candidate {
+				break
+			}
+			if candidate%p == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			primes = append(primes, candidate)
+		}
+	}
+	return primes
+}
+
+// sobolBits — разрядность направляющих чисел последовательности Соболя
+const sobolBits = 32
+
+// sobolDirections — примитивные многочлены и начальные направляющие числа
+// Джо-Куо (new-joe-kuo-6.21201) для измерений 2..MaxSobolDim.
+// Первое измерение — обратная двоичная функция (все m_i = 1).
+var sobolDirections = []struct {
+	s, a int
+	m    []uint32
+}{
+	{1, 0, []uint32{1}},
+	{2, 1, []uint32{1, 3}},
+	{3, 1, []uint32{1, 3, 1}},
+	{3, 2, []uint32{1, 1, 1}},
+	{4, 1, []uint32{1, 1, 3, 3}},
+	{4, 4, []uint32{1, 3, 5, 13}},
+	{5, 2, []uint32{1, 1, 5, 5, 17}},
+	{5, 4, []uint32{1, 1, 5, 5, 5}},
+	{5, 7, []uint32{1, 1, 7, 11, 19}},
+	{5, 11, []uint32{1, 1, 5, 1, 1}},
+	{5, 13, []uint32{1, 1, 1, 3, 11}},
+	{5, 14, []uint32{1, 3, 5, 5, 31}},
+	{6, 1, []uint32{1, 3, 3, 9, 7, 49}},
+	{6, 13, []uint32{1, 1, 1, 15, 21, 21}},
+	{6, 16, []uint32{1, 3, 1, 13, 27, 49}},
+	{6, 19, []uint32{1, 1, 1, 15, 7, 5}},
+	{6, 22, []uint32{1, 3, 1, 15, 13, 25}},
+	{6, 25, []uint32{1, 1, 5, 5, 19, 61}},
+	{7, 1, []uint32{1, 3, 7, 11, 23, 15, 103}},
+	{7, 4, []uint32{1, 3, 7, 13, 13, 15, 69}},
+}
+
+// sobolSampler — последовательность Соболя (генерация в коде Грея)
+// со случайным цифровым сдвигом (XOR), своим для каждой точки измерений
+type sobolSampler struct {
+	directions [][sobolBits]uint32
+	state      []uint32
+	index      uint32
+}
+
+func newSobolSampler(dim int, rng *rand.Rand) *sobolSampler {
+	s := &sobolSampler{
+		directions: make([][sobolBits]uint32, dim),
+		state:      make([]uint32, dim),
+	}
+
+	for d := range dim {
+		v := &s.directions[d]
+		if d == 0 {
+			for i := range v {
+				v[i] = 1 << (sobolBits - 1 - i)
+			}
+		} else {
+			dir := sobolDirections[d-1]
+			for i := 0; i < dir.s && i < sobolBits; i++ {
+				v[i] = dir.m[i] << (sobolBits - 1 - i)
+			}
+			for i := dir.s; i < sobolBits; i++ {
+				v[i] = v[i-dir.s] ^ (v[i-dir.s] >> dir.s)
+				for k := 1; k < dir.s; k++ {
+					v[i] ^= ((uint32(dir.a) >> (dir.s - 1 - k)) & 1) * v[i-k]
+				}
+			}
+		}
+		s.state[d] = rng.Uint32()
+	}
+	return s
+}
+
+func (s *sobolSampler) Next() []float64 {
+	u := make([]float64, len(s.state))
+	for d, x := range s.state {
+		u[d] = float64(x) / (1 << sobolBits)
+	}
+
+	// Следующая точка: XOR с направляющим числом младшего нулевого бита индекса
+	c := 0
+	for i := s.index; i&1 == 1; i >>= 1 {
+		c++
+	}
+	for d := range s.state {
+		s.state[d] ^= s.directions[d][c]
+	}
+	s.index++
+	return u
+}
+
+// latinHypercubeSampler — латинский гиперкуб: по каждому измерению n выборок
+// попадают в n разных равных интервалов, порядок интервалов случайный
+type latinHypercubeSampler struct {
+	points [][]float64
+	next   int
+	rng    *rand.Rand
+}
+
+func newLatinHypercubeSampler(dim, n int, rng *rand.Rand) *latinHypercubeSampler {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = make([]float64, dim)
+	}
+	for d := range dim {
+		perm := rng.Perm(n)
+		for i, stratum := range perm {
+			points[i][d] = (float64(stratum) + rng.Float64()) / float64(n)
+		}
+	}
+	return &latinHypercubeSampler{points: points, rng: rng}
+}
+
+func (s *latinHypercubeSampler) Next() []float64 {
+	if s.next >= len(s.points) {
+		// Запрошено больше выборок, чем заложено в гиперкуб
+		u := make([]float64, len(s.points[0]))
+		for i := range u {
+			u[i] = s.rng.Float64()
+		}
+		return u
+	}
+	u := s.points[s.next]
+	s.next++
+	return u
+}
@@ -0,0 +1,181 @@
+package optimization
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"lidar-classification/internal/domain"
+)
+
+// checkStrata проверяет, что в каждом из cells равных интервалов измерения d
+// лежит ровно count точек
+func checkStrata(t *testing.T, name string, points [][]float64, d, cells, count int) {
+	t.Helper()
+	hits := make([]int, cells)
+	for _, u := range points {
+		if u[d] < 0 || u[d] >= 1 {
+			t.Fatalf("%s: coordinate %d = %g is outside [0, 1)", name, d, u[d])
+		}
+		// Точки без сдвига лежат на границах интервалов; допуск учитывает округление
+		hits[min(cells-1, int(u[d]*float64(cells)+1e-9))]++
+	}
+	for cell, n := range hits {
+		if n != count {
+			t.Fatalf("%s: dimension %d, interval %d/%d has %d points, want %d", name, d, cell, cells, n, count)
+		}
+	}
+}
+
+// draw возвращает n следующих точек генератора
+func draw(s Sampler, n int) [][]float64 {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = s.Next()
+	}
+	return points
+}
+
+func TestFirstPrimes(t *testing.T) {
+	want := []int{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73}
+	if got := firstPrimes(domain.MaxSobolDim); !slices.Equal(got, want) {
+		t.Errorf("firstPrimes(%d) = %v, want %v", domain.MaxSobolDim, got, want)
+	}
+}
+
+func TestRadicalInverse(t *testing.T) {
+	tests := []struct {
+		index, base int
+		want        float64
+	}{
+		{1, 2, 0.5}, {2, 2, 0.25}, {3, 2, 0.75}, {6, 2, 0.375},
+		{1, 3, 1.0 / 3}, {5, 3, 7.0 / 9}, {9, 3, 1.0 / 27},
+		{72, 73, 72.0 / 73}, {74, 73, 1.0/73 + 1.0/(73*73)},
+	}
+	for _, tt := range tests {
+		if got := radicalInverse(tt.index, tt.base); math.Abs(got-tt.want) > 1e-15 {
+			t.Errorf("radicalInverse(%d, %d) = %g, want %g", tt.index, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestHaltonStratification(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	s := newHaltonSampler(domain.MaxSobolDim, rng)
+	// Без сдвига первые b^k точек по основанию b лежат по одной в интервалах 1/b^k
+	clear(s.shift)
+	points := draw(s, 3*3*3*3*3)
+
+	for d, base := range s.bases {
+		cells := base
+		for cells*base <= len(points) {
+			cells *= base
+		}
+		checkStrata(t, "halton", points[:cells], d, cells, 1)
+	}
+
+	// Случайный сдвиг оставляет точки в [0, 1)
+	shifted := draw(newHaltonSampler(domain.MaxSobolDim, rng), 1000)
+	for d := range domain.MaxSobolDim {
+		checkStrata(t, "shifted halton", shifted, d, 1, 1000)
+	}
+}
+
+func TestSobolStratification(t *testing.T) {
+	// Первое измерение не требует направляющих чисел из таблицы
+	if len(sobolDirections)+1 != domain.MaxSobolDim {
+		t.Fatalf("direction numbers cover %d dimensions, MaxSobolDim = %d", len(sobolDirections)+1, domain.MaxSobolDim)
+	}
+
+	const m = 10
+	rng := rand.New(rand.NewPCG(3, 4))
+	points := draw(newSobolSampler(domain.MaxSobolDim, rng), 1<<m)
+
+	// Цифровой сдвиг сохраняет свойства сети: первые 2^m точек лежат по одной
+	// в каждом из 2^m интервалов по каждому измерению
+	for d := range domain.MaxSobolDim {
+		checkStrata(t, "sobol", points, d, 1<<m, 1)
+		checkStrata(t, "sobol", points[:1<<(m-3)], d, 1<<(m-3), 1)
+	}
+
+	// Первые два измерения образуют (0, m, 2)-сеть: в каждом квадрате
+	// 2^-m/2 x 2^-m/2 ровно одна точка; для остальных пар проверяются
+	// квадраты 1/4 x 1/4 (по 64 точки)
+	for d1 := range domain.MaxSobolDim {
+		for d2 := d1 + 1; d2 < domain.MaxSobolDim; d2++ {
+			side := 4
+			if d1 == 0 && d2 == 1 {
+				side = 1 << (m / 2)
+			}
+			hits := make(map[[2]int]int)
+			for _, u := range points {
+				hits[[2]int{int(u[d1] * float64(side)), int(u[d2] * float64(side))}]++
+			}
+			want := len(points) / (side * side)
+			for cell, n := range hits {
+				if n != want {
+					t.Errorf("sobol: dimensions (%d, %d), square %v/%d has %d points, want %d",
+						d1, d2, cell, side, n, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestSobolUnshiftedValues(t *testing.T) {
+	s := newSobolSampler(2, rand.New(rand.NewPCG(5, 6)))
+	clear(s.state)
+
+	// Порядок кода Грея: первое измерение 0, 1/2, 3/4, 1/4, ...,
+	// второе — по многочлену x + 1 с m_1 = 1
+	want := [][]float64{
+		{0, 0}, {0.5, 0.5}, {0.75, 0.25}, {0.25, 0.75},
+		{0.375, 0.375}, {0.875, 0.875}, {0.625, 0.125}, {0.125, 0.625},
+	}
+	for i, w := range want {
+		if u := s.Next(); !slices.Equal(u, w) {
+			t.Fatalf("point %d = %v, want %v", i, u, w)
+		}
+	}
+}
+
+func TestLatinHypercube(t *testing.T) {
+	const dim, n = 12, 50
+	rng := rand.New(rand.NewPCG(7, 8))
+	s := newLatinHypercubeSampler(dim, n, rng)
+	points := draw(s, n)
+	for d := range dim {
+		checkStrata(t, "lhs", points, d, n, 1)
+	}
+
+	// Сверх n выборок возвращаются независимые случайные точки
+	extra := draw(s, 100)
+	for d := range dim {
+		checkStrata(t, "lhs extra", extra, d, 1, 100)
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	for _, kind := range []domain.Sampling{domain.SamplingRandom, domain.SamplingHalton, domain.SamplingSobol, domain.SamplingLHS} {
+		a := draw(NewSampler(kind, domain.MaxSobolDim, 20, rand.New(rand.NewPCG(9, 10))), 30)
+		b := draw(NewSampler(kind, domain.MaxSobolDim, 20, rand.New(rand.NewPCG(9, 10))), 30)
+		c := draw(NewSampler(kind, domain.MaxSobolDim, 20, rand.New(rand.NewPCG(9, 11))), 30)
+		for i := range a {
+			if len(a[i]) != domain.MaxSobolDim {
+				t.Fatalf("sampling %v: point has dimension %d, want %d", kind, len(a[i]), domain.MaxSobolDim)
+			}
+			if !slices.Equal(a[i], b[i]) {
+				t.Fatalf("sampling %v: same generator gives different points %v and %v", kind, a[i], b[i])
+			}
+		}
+		// Разные точки измерений получают разные наборы параметров
+		if slices.Equal(a[0], c[0]) {
+			t.Errorf("sampling %v: different generators give the same point %v", kind, a[0])
+		}
+		for d := range domain.MaxSobolDim {
+			checkStrata(t, "sampler", a, d, 1, len(a))
+		}
+	}
+}
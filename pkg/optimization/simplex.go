@@ -0,0 +1,115 @@
+package optimization
+
+import (
+	"lidar-classification/internal/domain"
+	"math"
+)
+
+// SimplexCostFunction — функция стоимости в неограниченном пространстве z,
+// которое отображается в доли компонент, всегда неотрицательные и
+// с суммой 1 (softmax или stick-breaking). Штрафы за ограничения не нужны,
+// поэтому функция гладкая, а градиент вычисляется по цепному правилу.
+type SimplexCostFunction struct {
+	cost  *CostFunction
+	param domain.Parameterization
+}
+
+func NewSimplexCostFunction(cost *CostFunction, param domain.Parameterization) *SimplexCostFunction {
+	return &SimplexCostFunction{
+		cost:  cost,
+		param: param,
+	}
+}
+
+// InitialPoint возвращает точку z, соответствующую равным долям n компонент
+func (s *SimplexCostFunction) InitialPoint(n int) []float64 {
+	if s.param == domain.ParamStickBreaking {
+		return make([]float64, n-1)
+	}
+	return make([]float64, n)
+}
+
+// Fractions отображает z в доли компонент
+func (s *SimplexCostFunction) Fractions(z []float64) []float64 {
+	if s.param == domain.ParamStickBreaking {
+		x, _, _ := stickBreaking(z)
+		return x
+	}
+	return softmax(z)
+}
+
+// Value возвращает невязку для долей, соответствующих z
+func (s *SimplexCostFunction) Value(z []float64) float64 {
+	return s.cost.calculateResidual(s.Fractions(z))
+}
+
+// Gradient вычисляет градиент по z: Jᵀ·∇f(x), где J — якобиан отображения z → x
+func (s *SimplexCostFunction) Gradient(z []float64) []float64 {
+	if s.param == domain.ParamStickBreaking {
+		x, v, rest := stickBreaking(z)
+		g := s.cost.residualGradient(x)
+		n := len(x)
+
+		// tail — средневзвешенный градиент по остатку "палки" после k-го разлома:
+		// tail(k) = Σ_{i>k} g_i x_i / rest(k+1)
+		grad := make([]float64, n-1)
+		tail := g[n-1]
+		for k := n - 2; k >= 0; k-- {
+			// dx/dv_k = rest_k·(e_k - доли остатка), dv_k/dz_k = v_k(1 - v_k)
+			grad[k] = rest[k] * (g[k] - tail) * v[k] * (1 - v[k])
+			tail = v[k]*g[k] + (1-v[k])*tail
+		}
+		return grad
+	}
+
+	x := softmax(z)
+	g := s.cost.residualGradient(x)
+	mean := 0.0
+	for k := range x {
+		mean += x[k] * g[k]
+	}
+	grad := make([]float64, len(x))
+	for k := range x {
+		grad[k] = x[k] * (g[k] - mean)
+	}
+	return grad
+}
+
+// softmax возвращает exp(z_k) / Σ exp(z_i)
+func softmax(z []float64) []float64 {
+	zMax := math.Inf(-1)
+	for _, v := range z {
+		zMax = math.Max(zMax, v)
+	}
+	x := make([]float64, len(z))
+	sum := 0.0
+	for k, v := range z {
+		x[k] = math.Exp(v - zMax)
+		sum += x[k]
+	}
+	for k := range x {
+		x[k] /= sum
+	}
+	return x
+}
+
+// stickBreaking отображает n-1 переменных z в n долей: от остатка "палки"
+// последовательно отламывается часть v_k = sigmoid(z_k - log(n-1-k)), последняя
+// доля забирает остаток. Сдвиг выбран так, что z = 0 дает равные доли.
+// Возвращает доли, v и длины остатка перед каждым разломом.
+func stickBreaking(z []float64) (x, v, rest []float64) {
+	n := len(z) + 1
+	x = make([]float64, n)
+	v = make([]float64, n-1)
+	rest = make([]float64, n)
+	remaining := 1.0
+	for k := range v {
+		v[k] = 1 / (1 + math.Exp(-(z[k] - math.Log(float64(n-1-k)))))
+		rest[k] = remaining
+		x[k] = remaining * v[k]
+		remaining *= 1 - v[k]
+	}
+	rest[n-1] = remaining
+	x[n-1] = remaining
+	return x, v, rest
+}
@@ -0,0 +1,167 @@
+package optimization
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"lidar-classification/internal/domain"
+)
+
+// checkSimplex проверяет, что доли неотрицательны, конечны и в сумме дают 1
+func checkSimplex(t *testing.T, x []float64) {
+	t.Helper()
+	sum := 0.0
+	for k, v := range x {
+		if math.IsNaN(v) || v < 0 || v > 1 {
+			t.Fatalf("fraction %d = %g in %v", k, v, x)
+		}
+		sum += v
+	}
+	if math.Abs(sum-1) > 1e-12 {
+		t.Fatalf("sum of %v = %.15f, want 1", x, sum)
+	}
+}
+
+func TestSoftmax(t *testing.T) {
+	x := softmax([]float64{0, math.Log(2), math.Log(5)})
+	want := []float64{0.125, 0.25, 0.625}
+	for k := range want {
+		if math.Abs(x[k]-want[k]) > 1e-15 {
+			t.Fatalf("softmax = %v, want %v", x, want)
+		}
+	}
+
+	// Сдвиг всех z не меняет доли
+	shifted := softmax([]float64{100, 100 + math.Log(2), 100 + math.Log(5)})
+	for k := range want {
+		if math.Abs(shifted[k]-want[k]) > 1e-15 {
+			t.Fatalf("shifted softmax = %v, want %v", shifted, want)
+		}
+	}
+
+	// Большие значения не переполняют экспоненту
+	x = softmax([]float64{1000, 0, -1000})
+	checkSimplex(t, x)
+	if x[0] != 1 {
+		t.Errorf("softmax(1000, 0, -1000) = %v, want [1 0 0]", x)
+	}
+}
+
+func TestStickBreaking(t *testing.T) {
+	for n := 2; n <= 6; n++ {
+		x, _, _ := stickBreaking(make([]float64, n-1))
+		for k := range x {
+			if math.Abs(x[k]-1/float64(n)) > 1e-15 {
+				t.Fatalf("n=%d: stickBreaking(0) = %v, want equal fractions", n, x)
+			}
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 100 {
+		z := make([]float64, 4)
+		for k := range z {
+			z[k] = 10 * rng.NormFloat64()
+		}
+		x, v, rest := stickBreaking(z)
+		checkSimplex(t, x)
+		// Каждая доля — отломанная часть остатка, остаток убывает
+		for k := range v {
+			if math.Abs(x[k]-rest[k]*v[k]) > 1e-15 || math.Abs(rest[k+1]-rest[k]*(1-v[k])) > 1e-15 {
+				t.Fatalf("z=%v: x=%v, v=%v, rest=%v are inconsistent", z, x, v, rest)
+			}
+		}
+	}
+
+	x, _, _ := stickBreaking([]float64{800, -800, 800})
+	checkSimplex(t, x)
+}
+
+// TestSimplexJacobians сравнивает якобианы отображений z → x с конечными
+// разностями: для softmax J = diag(x) - x·xᵀ, для stick-breaking
+// ∂x_k/∂z_k = rest_k·v_k(1-v_k) и ∂x_i/∂z_k = -x_i·v_k при i > k
+func TestSimplexJacobians(t *testing.T) {
+	const h = 1e-6
+	z := []float64{0.3, -1.2, 0.8, 2}
+
+	x := softmax(z)
+	for k := range z {
+		zp := append([]float64(nil), z...)
+		zm := append([]float64(nil), z...)
+		zp[k] += h
+		zm[k] -= h
+		xp, xm := softmax(zp), softmax(zm)
+		for i := range x {
+			want := -x[i] * x[k]
+			if i == k {
+				want += x[i]
+			}
+			if got := (xp[i] - xm[i]) / (2 * h); math.Abs(got-want) > 1e-8 {
+				t.Errorf("softmax: dx[%d]/dz[%d] = %g, want %g", i, k, got, want)
+			}
+		}
+	}
+
+	z = z[:3]
+	x, v, rest := stickBreaking(z)
+	for k := range z {
+		zp := append([]float64(nil), z...)
+		zm := append([]float64(nil), z...)
+		zp[k] += h
+		zm[k] -= h
+		xp, _, _ := stickBreaking(zp)
+		xm, _, _ := stickBreaking(zm)
+		for i := range x {
+			want := 0.0
+			switch {
+			case i == k:
+				want = rest[k] * v[k] * (1 - v[k])
+			case i > k:
+				want = -x[i] * v[k]
+			}
+			if got := (xp[i] - xm[i]) / (2 * h); math.Abs(got-want) > 1e-8 {
+				t.Errorf("stick-breaking: dx[%d]/dz[%d] = %g, want %g", i, k, got, want)
+			}
+		}
+	}
+}
+
+// TestSimplexCostFunctionGradient проверяет градиент по z (Jᵀ·∇f) для всех
+// функций потерь конечными разностями
+func TestSimplexCostFunctionGradient(t *testing.T) {
+	config := testConfig()
+	data := testPoint
+	params := domain.Parameters{
+		{Gf: 5e-5, DeltaPrime: 0.2, Mre: 1.42},
+		{Gf: 5e-5, DeltaPrime: 0.09, Mre: 1.54},
+		{Gf: 5e-4, DeltaPrime: 0.05, Mre: 1.52},
+		{Gf: 1e-6, DeltaPrime: 0.005, Mre: 1.34},
+	}
+	rng := rand.New(rand.NewPCG(3, 4))
+
+	for _, loss := range []string{"l2", "l1", "huber", "cauchy", "chi2"} {
+		config.CostFunction = loss
+		cost := NewCostFunction(zap.NewNop(), &data, &params, config)
+		for _, param := range []string{"softmax", "stickbreaking"} {
+			config.Parameterization = param
+			f := NewSimplexCostFunction(cost, config.GetParameterization())
+			for range 10 {
+				z := f.InitialPoint(len(params))
+				for k := range z {
+					z[k] = rng.NormFloat64()
+				}
+				analytic := f.Gradient(z)
+				numeric := numericGradient(f.Value, z)
+				for k := range z {
+					if math.Abs(analytic[k]-numeric[k]) > 1e-5*math.Max(1, math.Abs(numeric[k])) {
+						t.Errorf("%s/%s: z=%v: gradient %v, finite differences %v", loss, param, z, analytic, numeric)
+						break
+					}
+				}
+			}
+		}
+	}
+}
@@ -3,7 +3,7 @@ package optimization
 import (
 	"lidar-classification/internal/domain"
 	"math"
-	"math/rand"
+	"math/rand/v2"
 	"sort"
 
 	"github.com/physicist2018/optimization-go/optimization"
@@ -14,6 +14,11 @@ const (
 	HUGE_VAL = 1000000000.0
 )
 
+// lbfgsSumTolerance — допустимое отклонение суммы долей от 1 в методе lbfgs
+// с параметризацией direct; чуть меньше sumTolerance, чтобы ошибки округления
+// проекции не выводили сумму за допуск штрафа calcSmoothPenalty
+const lbfgsSumTolerance = sumTolerance - 1e-9
+
 type MonteCarloOptimizer struct {
 	logger *zap.Logger
 }
@@ -24,56 +29,129 @@ func NewMonteCarloOptimizer(logger *zap.Logger) *MonteCarloOptimizer {
 
 func (o *MonteCarloOptimizer) Solve(data *domain.PointData, config *domain.Config) *domain.Solution {
 	var samples []*domain.Solution
+	trace := pointTracer(o.logger, data, config)
+	rng := newPointRand(config.Seed, data.I, data.J)
+	sampler := NewSampler(config.GetSampling(), 3*len(config.Components), config.NSamples, rng)
+	adaptive := config.Adaptive
+	var prevMean, prevStd []float64
+
+	// Выборки точки для записи в файл и номера записей решений с невязкой меньше epsilon
+	var records []domain.SampleRecord
+	var recordIndex map[*domain.Solution]int
+	if data.Dump {
+		recordIndex = make(map[*domain.Solution]int)
+	}
 
-	for _ = range config.NSamples {
-		sample := o.generateRandomSample(data, config)
+	attempts := 0
+	for attempts < config.NSamples {
+		sample, result := o.generateRandomSample(rng, sampler, data, config, trace)
+		attempts++
+		if data.Dump {
+			records = append(records, domain.SampleRecord{
+				Attempt:    attempts,
+				Parameters: sample.Parameters,
+				Fractions:  sample.Fractions,
+				Residual:   sample.Residual,
+				Iterations: result.Iterations,
+				Converged:  result.Converged,
+				Valid:      sample.IsValid,
+			})
+			if sample.IsValid {
+				recordIndex[sample] = len(records) - 1
+			}
+		}
+		if trace != nil {
+			trace.Info("Sample",
+				zap.Int("attempt", attempts),
+				zap.Any("parameters", sample.Parameters),
+				zap.Float64s("fractions", sample.Fractions),
+				zap.Float64("residual", sample.Residual),
+				zap.Bool("valid", sample.IsValid))
+		}
 		// здесь не обязательно проверять попадание в eps && sample.Residual <= config.Epsilon
 		if sample.IsValid {
 			samples = append(samples, sample)
 		}
+
+		if !adaptive.Enabled {
+			continue
+		}
+		if len(samples) == 0 && adaptive.GiveUpAfter > 0 && attempts >= adaptive.GiveUpAfter {
+			o.logger.Debug("No valid samples, giving up", zap.Int("i", data.I), zap.Int("j", data.J),
+				zap.Int("attempts", attempts))
+			break
+		}
+		if attempts < adaptive.MinSamples || (attempts-adaptive.MinSamples)%adaptive.BatchSize != 0 {
+			continue
+		}
+
+		// Проверка сходимости: среднее и разброс долей по лучшим решениям
+		// не изменились больше чем на tolerance с предыдущей проверки
+		best := o.selectBest(samples, config.N1)
+		if len(best) < config.N1 {
+			// Ансамбль из N1 лучших решений еще не набран
+			continue
+		}
+		mean, std := o.fractionsStats(best, config.GetAveraging())
+		if prevMean != nil && maxAbsDiff(mean, prevMean) <= adaptive.Tolerance && maxAbsDiff(std, prevStd) <= adaptive.Tolerance {
+			break
+		}
+		prevMean, prevStd = mean, std
 	}
 
-	o.logger.Info("number of samples with valid solution", zap.Int("count", len(samples)))
 	if len(samples) == 0 {
-		return &domain.Solution{IsValid: false}
+		if trace != nil {
+			trace.Info("No valid solution", zap.Int("attempts", attempts))
+		}
+		return &domain.Solution{IsValid: false, Samples: attempts, SampleRecords: records}
 	}
 
-	// Сортируем по невязке
-	sort.Slice(samples, func(i, j int) bool {
-		return samples[i].Residual < samples[j].Residual
-	})
-
-	// в отсортированном массиме ищем количество решений где невязка не inf
-	count := 0
-	for _, sample := range samples {
-		if !math.IsInf(sample.Residual, 1) {
-			count++
+	// Берем лучшие N1 решений
+	bestSamples := o.selectBest(samples, config.N1)
+	for _, best := range bestSamples {
+		if k, ok := recordIndex[best]; ok {
+			records[k].Best = true
 		}
 	}
 
-	// Берем лучшие N1 решений
-	n1 := min(config.N1, count)
-	o.logger.Info("average count", zap.Int("count", n1))
-	bestSamples := samples[:n1]
-
-	// Усредняем результаты
-	avg := o.averageSolutions(bestSamples)
-
-	avg.Difference = CalculateEquations(avg.Fractions.Array(), &config.LR, &config.CV, &avg.Parameters)
-	avg.Difference[0] = (1 - avg.Difference[0]) * 100.0
-	avg.Difference[1] = (data.DeltaPrime - avg.Difference[1]) / data.DeltaPrime * 100.0
-	avg.Difference[2] = (data.Gf - avg.Difference[2]) / data.Gf * 100.0
-	avg.Difference[3] = (data.M - avg.Difference[3]) / data.M * 100.0
-	o.logger.Info("best", zap.Any("X", avg))
+	// Усредняем результаты и оцениваем разброс по ансамблю
+	avg := o.averageSolutions(bestSamples, config.GetAveraging())
+	ensembleSpread(avg, bestSamples, config.Percentiles)
+	avg.Samples = attempts
+	avg.SampleRecords = records
+
+	avg.Difference = equationDifferences(data, avg, config.Components)
+	if trace != nil {
+		trace.Info("Solution",
+			zap.Int("attempts", attempts),
+			zap.Int("valid", len(samples)),
+			zap.Int("averaged", len(bestSamples)),
+			zap.Any("solution", avg))
+	}
 	return avg
 
 }
 
-func (o *MonteCarloOptimizer) generateRandomSample(data *domain.PointData, config *domain.Config) *domain.Solution {
-	params := o.generateRandomParameters(config)
+// equationDifferences возвращает относительные отклонения (в процентах)
+// левых частей уравнений смеси для решения sol от измеренных значений
+func equationDifferences(data *domain.PointData, sol *domain.Solution, components []domain.Component) []float64 {
+	diff := CalculateEquations(sol.Fractions, components, &sol.Parameters)
+	diff[0] = (1 - diff[0]) * 100.0
+	diff[1] = (data.DeltaPrime - diff[1]) / data.DeltaPrime * 100.0
+	diff[2] = (data.Gf - diff[2]) / data.Gf * 100.0
+	diff[3] = (data.M - diff[3]) / data.M * 100.0
+	return diff
+}
+
+// generateRandomSample решает систему для случайной выборки параметров.
+// Возвращает решение и результат оптимизатора (число итераций, сходимость).
+func (o *MonteCarloOptimizer) generateRandomSample(rng *rand.Rand, sampler Sampler, data *domain.PointData,
+	config *domain.Config, trace *zap.Logger) (*domain.Solution, optimization.OptimizerResult) {
+
+	params := o.generateRandomParameters(sampler.Next(), config)
 
 	// Решаем систему уравнений
-	fractions, residual := o.solveSystem(data, params, config)
+	fractions, residual, result := o.solveSystem(rng, data, params, config, trace)
 
 	//&& residual <= config.Epsilon &&
 	// fractions.D >= 0 && fractions.U >= 0 && fractions.S >= 0 && fractions.W >= 0 &&
@@ -84,11 +162,26 @@ func (o *MonteCarloOptimizer) generateRandomSample(data *domain.PointData, confi
 		Parameters: *params,
 
 		IsValid: residual >= 0 && residual < config.Epsilon,
-	}
+	}, result
 }
 
-func (o *MonteCarloOptimizer) solveSystem(data *domain.PointData, params *domain.Parameters,
-	config *domain.Config) (domain.Fractions, float64) {
+func (o *MonteCarloOptimizer) solveSystem(rng *rand.Rand, data *domain.PointData, params *domain.Parameters,
+	config *domain.Config, trace *zap.Logger) (domain.Fractions, float64, optimization.OptimizerResult) {
+
+	costFunc := NewCostFunction(
+		o.logger,
+		data,
+		params,
+		config,
+	)
+	costFunc.trace = trace
+
+	// Линеаризованная задача решается напрямую, без итерационного оптимизатора
+	if config.GetOptMethod() == domain.MethodLeastSquares {
+		x := SolveLinearized(data, params, config.Components)
+		value := costFunc.Value(x)
+		return domain.Fractions(x), value, optimization.OptimizerResult{X: x, Value: value, Converged: true}
+	}
 
 	var opt optimization.Optimizer
 	//nmConf := optimization.DefaultNelderMeadConfig()
@@ -106,109 +199,200 @@ func (o *MonteCarloOptimizer) solveSystem(data *domain.PointData, params *domain
 		opt = optimization.NewAdaptiveGradientDescent(gdConf)
 	case domain.MethodSimulatedAnnealing:
 		saConf := optimization.DefaultSimulatedAnnealingConfig()
+		saConf.Seed = rng.Int64() | 1 // нулевой seed оптимизатор заменяет текущим временем
 		opt = optimization.NewSimulatedAnnealing(saConf)
+	case domain.MethodLBFGSB:
+		lbConf := DefaultLBFGSBConfig()
+		lbConf.Tolerance = 1e-5
+		if config.GetParameterization() != domain.ParamDirect {
+			// В пространстве z переменные не ограничены
+			lbConf.Lower, lbConf.Upper = math.Inf(-1), math.Inf(1)
+		} else {
+			// Сумма долей удерживается внутри допуска штрафа calcSmoothPenalty:
+			// на его границе штраф меняется скачком, который градиент не видит
+			lbConf.SumLower, lbConf.SumUpper = 1-lbfgsSumTolerance, 1+lbfgsSumTolerance
+		}
+		opt = NewLBFGSB(lbConf)
 	}
 
-	costFunc := NewCostFunction(
-		o.logger,
-		data,
-		params,
-		config,
-	)
+	n := len(config.Components)
+	if param := config.GetParameterization(); param != domain.ParamDirect {
+		// Оптимизация в неограниченном пространстве без штрафов
+		simplexFunc := NewSimplexCostFunction(costFunc, param)
+		result := opt.Optimize(simplexFunc, simplexFunc.InitialPoint(n))
+		if trace != nil {
+			trace.Info("Optimization result", zap.Any("result", result))
+		}
+
+		return domain.Fractions(simplexFunc.Fractions(result.X)), result.Value, result
+	}
 
 	// Начальное приближение - равные доли
-	initial := []float64{0.25, 0.25, 0.25, 0.25}
+	initial := make([]float64, n)
+	for k := range initial {
+		initial[k] = 1.0 / float64(n)
+	}
 	result := opt.Optimize(costFunc, initial)
+	if trace != nil {
+		trace.Info("Optimization result", zap.Any("result", result))
+	}
+
+	return domain.Fractions(result.X), result.Value, result
+}
+
+// generateRandomParameters отображает точку единичного гиперкуба u
+// (по три координаты Gf, delta, m на компоненту) в значения параметров
+// через обратные функции их априорных распределений
+func (o *MonteCarloOptimizer) generateRandomParameters(u []float64, config *domain.Config) *domain.Parameters {
+	params := make(domain.Parameters, len(config.Components))
+	for k, comp := range config.Components {
+		delta := comp.DeltaRange.Quantile(u[3*k+1])
+		params[k] = domain.ComponentParameters{
+			Gf:         comp.GfRange.Quantile(u[3*k]),
+			DeltaPrime: delta / (1 + delta),
+			Mre:        comp.MRange.Quantile(u[3*k+2]),
+		}
+	}
+	return &params
+}
+
+// averageSolutions усредняет решения способом averaging. Невязка результата
+// усредняется с теми же весами (для медианы берется медиана невязок).
+func (o *MonteCarloOptimizer) averageSolutions(samples []*domain.Solution, averaging domain.Averaging) *domain.Solution {
+	if averaging == domain.AverageMedian {
+		return medianSolution(samples)
+	}
 
-	o.logger.Debug("Optimization result:", zap.Any("result", result))
+	weights := solutionWeights(samples, averaging)
+	var sumResidual, sumWeights float64
+	n := len(samples[0].Fractions)
+	sumFractions := make([]float64, n)
+	sumParams := make([]float64, 3*n)
+
+	for i, sample := range samples {
+		w := weights[i]
+		sumWeights += w
+		sumResidual += w * sample.Residual
+		for k, value := range sample.Fractions {
+			sumFractions[k] += w * value
+		}
+		for k, value := range sample.Parameters.Array() {
+			sumParams[k] += w * value
+		}
+	}
 
-	fractions := domain.Fractions{
-		D: result.X[0],
-		U: result.X[1],
-		S: result.X[2],
-		W: result.X[3],
+	for k := range sumFractions {
+		sumFractions[k] /= sumWeights
+	}
+	for k := range sumParams {
+		sumParams[k] /= sumWeights
 	}
 
-	return fractions, result.Value
+	return &domain.Solution{
+		Residual:   sumResidual / sumWeights,
+		Fractions:  domain.Fractions(sumFractions),
+		Parameters: domain.ParametersFromArray(sumParams),
+		IsValid:    true,
+	}
 }
 
-func (o *MonteCarloOptimizer) generateRandomParameters(config *domain.Config) *domain.Parameters {
-	deltaD := randomInRange(config.DeltaRange.D[0], config.DeltaRange.D[1])
-	deltaU := randomInRange(config.DeltaRange.U[0], config.DeltaRange.U[1])
-	deltaS := randomInRange(config.DeltaRange.S[0], config.DeltaRange.S[1])
-	deltaW := randomInRange(config.DeltaRange.W[0], config.DeltaRange.W[1])
-	return &domain.Parameters{
-		GfD:         randomInRange(config.GfRange.D[0], config.GfRange.D[1]),
-		GfU:         randomInRange(config.GfRange.U[0], config.GfRange.U[1]),
-		GfS:         randomInRange(config.GfRange.S[0], config.GfRange.S[1]),
-		GfW:         randomInRange(config.GfRange.W[0], config.GfRange.W[1]),
-		DeltaDPrime: deltaD / (1 + deltaD),
-		DeltaUPrime: deltaU / (1 + deltaU),
-		DeltaSPrime: deltaS / (1 + deltaS),
-		DeltaWPrime: deltaW / (1 + deltaW),
-		MreD:        randomInRange(config.MRange.D[0], config.MRange.D[1]),
-		MreU:        randomInRange(config.MRange.U[0], config.MRange.U[1]),
-		MreS:        randomInRange(config.MRange.S[0], config.MRange.S[1]),
-		MreW:        randomInRange(config.MRange.W[0], config.MRange.W[1]),
+// selectBest сортирует samples по невязке и возвращает не более n1 лучших
+// решений с конечной невязкой
+func (o *MonteCarloOptimizer) selectBest(samples []*domain.Solution, n1 int) []*domain.Solution {
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Residual < samples[j].Residual
+	})
+
+	// в отсортированном массиве ищем количество решений где невязка не inf
+	count := 0
+	for _, sample := range samples {
+		if !math.IsInf(sample.Residual, 1) {
+			count++
+		}
 	}
+	return samples[:min(n1, count)]
 }
 
-func (o *MonteCarloOptimizer) averageSolutions(samples []*domain.Solution) *domain.Solution {
-	var sumResidual float64
-	var sumFractions domain.Fractions
-	var sumParams domain.Parameters
-	count := len(samples)
+// fractionsStats возвращает усредненные способом averaging доли и их
+// стандартное отклонение по ансамблю samples
+func (o *MonteCarloOptimizer) fractionsStats(samples []*domain.Solution, averaging domain.Averaging) (mean, std []float64) {
+	mean = o.averageSolutions(samples, averaging).Fractions
+	rows := make([][]float64, len(samples))
+	for k, sample := range samples {
+		rows[k] = sample.Fractions
+	}
+	return mean, columnStd(rows, mean)
+}
+
+// maxAbsDiff возвращает наибольшую по модулю разность элементов a и b
+func maxAbsDiff(a, b []float64) float64 {
+	var d float64
+	for i := range a {
+		d = math.Max(d, math.Abs(a[i]-b[i]))
+	}
+	return d
+}
 
+// minWeightResidual — нижняя граница невязки при вычислении весов 1/невязка
+const minWeightResidual = 1e-12
+
+// solutionWeights возвращает (ненормированные) веса решений для усреднения
+func solutionWeights(samples []*domain.Solution, averaging domain.Averaging) []float64 {
+	best := math.Inf(1)
 	for _, sample := range samples {
-		sumResidual += sample.Residual
-		sumFractions.D += sample.Fractions.D
-		sumFractions.U += sample.Fractions.U
-		sumFractions.S += sample.Fractions.S
-		sumFractions.W += sample.Fractions.W
-		sumParams.GfD += sample.Parameters.GfD
-		sumParams.GfU += sample.Parameters.GfU
-		sumParams.GfS += sample.Parameters.GfS
-		sumParams.GfW += sample.Parameters.GfW
-		sumParams.DeltaDPrime += sample.Parameters.DeltaDPrime
-		sumParams.DeltaUPrime += sample.Parameters.DeltaUPrime
-		sumParams.DeltaSPrime += sample.Parameters.DeltaSPrime
-		sumParams.DeltaWPrime += sample.Parameters.DeltaWPrime
-		sumParams.MreD += sample.Parameters.MreD
-		sumParams.MreU += sample.Parameters.MreU
-		sumParams.MreS += sample.Parameters.MreS
-		sumParams.MreW += sample.Parameters.MreW
-	}
-
-	avgResidual := sumResidual / float64(count)
-	avgFractions := domain.Fractions{
-		D: sumFractions.D / float64(count),
-		U: sumFractions.U / float64(count),
-		S: sumFractions.S / float64(count),
-		W: sumFractions.W / float64(count),
-	}
-	avgParams := domain.Parameters{
-		GfD:         sumParams.GfD / float64(count),
-		GfU:         sumParams.GfU / float64(count),
-		GfS:         sumParams.GfS / float64(count),
-		GfW:         sumParams.GfW / float64(count),
-		DeltaDPrime: sumParams.DeltaDPrime / float64(count),
-		DeltaUPrime: sumParams.DeltaUPrime / float64(count),
-		DeltaSPrime: sumParams.DeltaSPrime / float64(count),
-		DeltaWPrime: sumParams.DeltaWPrime / float64(count),
-		MreD:        sumParams.MreD / float64(count),
-		MreU:        sumParams.MreU / float64(count),
-		MreS:        sumParams.MreS / float64(count),
-		MreW:        sumParams.MreW / float64(count),
+		best = math.Min(best, sample.Residual)
+	}
+
+	weights := make([]float64, len(samples))
+	for i, sample := range samples {
+		switch averaging {
+		case domain.AverageInverseResidual:
+			weights[i] = 1 / math.Max(sample.Residual, minWeightResidual)
+		case domain.AverageLikelihood:
+			// Сдвиг на лучшую невязку не меняет относительных весов,
+			// но не дает всем весам обратиться в ноль при больших невязках
+			weights[i] = math.Exp(-(sample.Residual*sample.Residual - best*best) / 2)
+		default:
+			weights[i] = 1
+		}
+	}
+	return weights
+}
+
+// medianSolution возвращает покомпонентные медианы долей, параметров и невязок.
+// Сумма медианных долей, в отличие от среднего, может отличаться от 1.
+func medianSolution(samples []*domain.Solution) *domain.Solution {
+	fractions := make([][]float64, len(samples))
+	params := make([][]float64, len(samples))
+	residuals := make([][]float64, len(samples))
+	for k, sample := range samples {
+		fractions[k] = sample.Fractions
+		params[k] = sample.Parameters.Array()
+		residuals[k] = []float64{sample.Residual}
 	}
 
+	median := []float64{50}
 	return &domain.Solution{
-		Residual:   avgResidual,
-		Fractions:  avgFractions,
-		Parameters: avgParams,
+		Residual:   columnPercentiles(residuals, median)[0][0],
+		Fractions:  domain.Fractions(columnPercentiles(fractions, median)[0]),
+		Parameters: domain.ParametersFromArray(columnPercentiles(params, median)[0]),
 		IsValid:    true,
 	}
 }
 
-func randomInRange(min, max float64) float64 {
-	return min + rand.Float64()*(max-min)
+// newPointRand создает генератор случайных чисел для точки (i, j). Поток
+// определяется только seed и координатами точки, поэтому результаты не зависят
+// от числа воркеров и порядка обработки.
+func newPointRand(seed int64, i, j int) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), uint64(i)<<32|uint64(uint32(j))))
+}
+
+// pointTracer возвращает журнал диагностики точки data или nil, если для нее
+// диагностика не включена (см. domain.TraceConfig). Проверка на nil перед
+// записью избавляет от формирования полей записей в остальных точках.
+func pointTracer(logger *zap.Logger, data *domain.PointData, config *domain.Config) *zap.Logger {
+	if !config.Trace.Selected(config.Seed, data.I, data.J) {
+		return nil
+	}
+	return logger.Named("trace").With(zap.Int("i", data.I), zap.Int("j", data.J))
 }
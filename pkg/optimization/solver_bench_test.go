@@ -0,0 +1,47 @@
+package optimization
+
+import (
+	"io"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"lidar-classification/internal/domain"
+)
+
+// benchmarkLogger возвращает журнал уровня info, как при обычном запуске,
+// с выводом в io.Discard, чтобы учитывалась только стоимость формирования записей
+func benchmarkLogger() *zap.Logger {
+	encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	return zap.New(zapcore.NewCore(encoder, zapcore.AddSync(io.Discard), zap.InfoLevel))
+}
+
+func BenchmarkCostFunctionValue(b *testing.B) {
+	config := testConfig()
+	data := testPoint
+	params := domain.Parameters{
+		{Gf: 5e-5, DeltaPrime: 0.2, Mre: 1.42},
+		{Gf: 5e-5, DeltaPrime: 0.09, Mre: 1.54},
+		{Gf: 5e-4, DeltaPrime: 0.05, Mre: 1.52},
+		{Gf: 1e-6, DeltaPrime: 0.005, Mre: 1.34},
+	}
+	cost := NewCostFunction(benchmarkLogger(), &data, &params, config)
+	x := []float64{0.4, 0.1, 0.3, 0.2}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		cost.Value(x)
+	}
+}
+
+func BenchmarkMonteCarloSolve(b *testing.B) {
+	config := testConfig()
+	optimizer := NewMonteCarloOptimizer(benchmarkLogger())
+
+	b.ReportAllocs()
+	for b.Loop() {
+		data := testPoint
+		optimizer.Solve(&data, config)
+	}
+}
@@ -0,0 +1,220 @@
+package optimization
+
+import (
+	"math"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"lidar-classification/internal/domain"
+)
+
+// averagingSamples — решения с невязками разного порядка
+func averagingSamples() []*domain.Solution {
+	sample := func(residual, nd, gf float64) *domain.Solution {
+		return &domain.Solution{
+			Residual:  residual,
+			Fractions: domain.Fractions{nd, 1 - nd},
+			Parameters: domain.Parameters{
+				{Gf: gf, DeltaPrime: 0.2, Mre: 1.42},
+				{Gf: 5e-4, DeltaPrime: 0.05, Mre: 1.52},
+			},
+			IsValid: true,
+		}
+	}
+	return []*domain.Solution{
+		sample(0.1, 0.2, 1e-5),
+		sample(0.5, 0.6, 2e-5),
+		sample(2, 1, 6e-5),
+	}
+}
+
+func TestAverageSolutions(t *testing.T) {
+	residuals := []float64{0.1, 0.5, 2}
+	nd := []float64{0.2, 0.6, 1}
+	gf := []float64{1e-5, 2e-5, 6e-5}
+	// weighted возвращает средние доли, Gf первой компоненты и невязку с весами w
+	weighted := func(w func(residual float64) float64) [3]float64 {
+		var sum, sumW [3]float64
+		for k, r := range residuals {
+			for i, v := range []float64{nd[k], gf[k], r} {
+				sum[i] += w(r) * v
+				sumW[i] += w(r)
+			}
+		}
+		return [3]float64{sum[0] / sumW[0], sum[1] / sumW[1], sum[2] / sumW[2]}
+	}
+
+	tests := []struct {
+		name      string
+		averaging domain.Averaging
+		// want — доля первой компоненты, ее Gf и невязка результата
+		want [3]float64
+	}{
+		{name: "equal", averaging: domain.AverageEqual, want: [3]float64{0.6, 3e-5, 2.6 / 3}},
+		{
+			name:      "inverse residual",
+			averaging: domain.AverageInverseResidual,
+			want:      weighted(func(r float64) float64 { return 1 / r }),
+		},
+		{
+			name:      "likelihood",
+			averaging: domain.AverageLikelihood,
+			want:      weighted(func(r float64) float64 { return math.Exp(-r * r / 2) }),
+		},
+		{name: "median", averaging: domain.AverageMedian, want: [3]float64{0.6, 2e-5, 0.5}},
+	}
+
+	o := NewMonteCarloOptimizer(zap.NewNop())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			avg := o.averageSolutions(averagingSamples(), tt.averaging)
+			got := [3]float64{avg.Fractions[0], avg.Parameters[0].Gf, avg.Residual}
+			for k := range got {
+				if math.Abs(got[k]-tt.want[k]) > 1e-12*math.Max(1, math.Abs(tt.want[k])) {
+					t.Fatalf("n_d, GF_d, residual = %v, want %v", got, tt.want)
+				}
+			}
+			if !avg.IsValid || math.Abs(avg.Fractions[0]+avg.Fractions[1]-1) > 1e-12 {
+				t.Errorf("fractions = %v, valid = %v, want valid with sum 1", avg.Fractions, avg.IsValid)
+			}
+		})
+	}
+}
+
+// TestAverageSolutionsZeroResidual проверяет, что решение с нулевой невязкой
+// получает наибольший конечный вес 1/невязка, а не делает результат NaN
+func TestAverageSolutionsZeroResidual(t *testing.T) {
+	samples := averagingSamples()
+	samples[1].Residual = 0
+
+	avg := NewMonteCarloOptimizer(zap.NewNop()).averageSolutions(samples, domain.AverageInverseResidual)
+	if math.Abs(avg.Fractions[0]-0.6) > 1e-9 || math.IsNaN(avg.Residual) {
+		t.Errorf("n_d = %g, residual = %g, want 0.6 from the exact solution", avg.Fractions[0], avg.Residual)
+	}
+}
+
+// TestLikelihoodWeightsLargeResiduals проверяет, что при больших невязках
+// веса exp(-невязка²/2) не обращаются в ноль все сразу
+func TestLikelihoodWeightsLargeResiduals(t *testing.T) {
+	samples := averagingSamples()
+	for _, sample := range samples {
+		sample.Residual += 50
+	}
+
+	avg := NewMonteCarloOptimizer(zap.NewNop()).averageSolutions(samples, domain.AverageLikelihood)
+	if math.IsNaN(avg.Fractions[0]) || avg.Fractions[0] < 0.2 || avg.Fractions[0] > 0.21 {
+		t.Errorf("n_d = %g, want close to 0.2 of the best solution", avg.Fractions[0])
+	}
+}
+
+func TestMonteCarloAdaptiveSamples(t *testing.T) {
+	// infeasible — точка с коэффициентом преломления вне диапазонов компонент
+	infeasible := testPoint
+	infeasible.M = 3
+
+	tests := []struct {
+		name     string
+		point    domain.PointData
+		adaptive domain.AdaptiveConfig
+		// wantStop — выборки прекращены до исчерпания NSamples
+		wantStop  bool
+		wantValid bool
+		// wantSamples — ожидаемое число выборок (0 — не проверяется)
+		wantSamples int
+	}{
+		{
+			name:        "fixed count",
+			point:       testPoint,
+			wantValid:   true,
+			wantSamples: 300,
+		},
+		{
+			name:      "converged ensemble",
+			point:     testPoint,
+			adaptive:  domain.AdaptiveConfig{Enabled: true, MinSamples: 20, BatchSize: 10, Tolerance: 0.01},
+			wantStop:  true,
+			wantValid: true,
+		},
+		{
+			name:        "give up without valid samples",
+			point:       infeasible,
+			adaptive:    domain.AdaptiveConfig{Enabled: true, MinSamples: 20, BatchSize: 10, Tolerance: 0.01, GiveUpAfter: 40},
+			wantStop:    true,
+			wantSamples: 40,
+		},
+		{
+			name:        "no give up",
+			point:       infeasible,
+			adaptive:    domain.AdaptiveConfig{Enabled: true, MinSamples: 20, BatchSize: 10, Tolerance: 0.01},
+			wantSamples: 300,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.Method = "lsq"
+			config.NSamples = 300
+			config.Adaptive = tt.adaptive
+
+			sol := NewMonteCarloOptimizer(zap.NewNop()).Solve(&tt.point, config)
+			if sol.IsValid != tt.wantValid {
+				t.Fatalf("valid = %v, want %v", sol.IsValid, tt.wantValid)
+			}
+			if stopped := sol.Samples < config.NSamples; stopped != tt.wantStop {
+				t.Errorf("samples = %d of %d, want early stop %v", sol.Samples, config.NSamples, tt.wantStop)
+			}
+			if tt.wantSamples > 0 && sol.Samples != tt.wantSamples {
+				t.Errorf("samples = %d, want %d", sol.Samples, tt.wantSamples)
+			}
+			if tt.wantStop && tt.wantValid {
+				// Сходимость проверяется после MinSamples и далее каждые BatchSize выборок
+				a := tt.adaptive
+				if sol.Samples < a.MinSamples+a.BatchSize || (sol.Samples-a.MinSamples)%a.BatchSize != 0 {
+					t.Errorf("stopped after %d samples, not at a convergence check", sol.Samples)
+				}
+			}
+		})
+	}
+}
+
+// TestMonteCarloTraceSelectedPoint проверяет, что подробная диагностика
+// пишется в журнал trace только для выбранной точки
+func TestMonteCarloTraceSelectedPoint(t *testing.T) {
+	config := testConfig()
+	config.Method = "lsq"
+	config.Trace = domain.TraceConfig{Points: [][2]int{{0, 1}}}
+
+	for _, point := range [][2]int{{0, 1}, {0, 0}, {1, 1}} {
+		core, logs := observer.New(zap.InfoLevel)
+		data := testPoint
+		data.I, data.J = point[0], point[1]
+		sol := NewMonteCarloOptimizer(zap.New(core)).Solve(&data, config)
+		if !sol.IsValid {
+			t.Fatalf("point %v: no solution", point)
+		}
+
+		traced := logs.Filter(func(e observer.LoggedEntry) bool { return e.LoggerName == "trace" })
+		if point != [2]int{0, 1} {
+			if n := logs.Len(); n != 0 {
+				t.Errorf("point %v is not selected, got %d log entries", point, n)
+			}
+			continue
+		}
+
+		if n := traced.FilterMessage("Sample").Len(); n != config.NSamples {
+			t.Errorf("got %d Sample entries, want %d", n, config.NSamples)
+		}
+		if traced.FilterMessage("Solution").Len() != 1 {
+			t.Error("Solution entry not written")
+		}
+		for _, entry := range traced.All() {
+			fields := entry.ContextMap()
+			if fields["i"] != int64(0) || fields["j"] != int64(1) {
+				t.Fatalf("entry %q has point (%v, %v), want (0, 1)", entry.Message, fields["i"], fields["j"])
+			}
+		}
+	}
+}